@@ -1,171 +1,92 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"net/http"
-	"net/url"
 	"strings"
 	"syscall"
 
+	"github.com/Andrew-Morozko/cloudy-uploader/overcast"
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/ssh/terminal"
 )
 
-type AuthData struct {
-	Creds   *Creds
-	Cookies BasicCookies
-}
-
-type BasicCookie struct {
-	Name  string
-	Value string
-}
-
-type BasicCookies []*BasicCookie
-
-type Creds struct {
-	Email    string
-	Password string
-}
-
-func (creds *Creds) Auth() (uploads *http.Response, err error) {
-	if creds == nil || (creds.Email == "" && creds.Password == "") {
-		return nil, errors.New("no credentials")
-	}
-
-	postdata := url.Values{
-		"then":     {"uploads"},
-		"email":    {creds.Email},
-		"password": {creds.Password},
-	}
-
-	resp, err := client.PostForm("https://overcast.fm/login", postdata)
-	if err != nil {
-		return
-	}
-	defer func() {
-		if err != nil {
-			resp.Body.Close()
-		}
-	}()
-
-	if resp.StatusCode != 200 {
-		err = errors.Errorf("unexpected HTTP response on login: %d", resp.StatusCode)
-		return
-	}
-
-	if strings.HasSuffix(resp.Request.URL.Path, "login") {
-		err = errors.New("failed to login: wrong password")
-		return
-	}
-
-	if !strings.HasSuffix(resp.Request.URL.Path, "uploads") {
-		err = errors.Errorf("failed to login: request in unknown place %s", resp.Request.URL.String())
-		return
-	}
-
-	return resp, nil
-}
-
-func (bc BasicCookies) Auth() (uploads *http.Response, err error) {
-	if len(bc) == 0 {
-		return nil, errors.New("no cookies found")
-	}
-
-	cookies := make([]*http.Cookie, len(bc))
-	for i, cookie := range bc {
-		cookies[i] = &http.Cookie{
-			Name:  cookie.Name,
-			Value: cookie.Value,
-		}
-	}
-	client.Jar.SetCookies(overcastURL, cookies)
-
-	uploads, err = client.Get("https://overcast.fm/uploads")
-	if err != nil {
-		err = errors.WithMessage(err, "failed to load uploads page")
-		return
-	}
-	defer func() {
-		if err != nil {
-			uploads.Body.Close()
-			uploads = nil
-		}
-	}()
-
-	if !strings.HasSuffix(uploads.Request.URL.Path, "uploads") {
-		err = errors.New("cookies have expired")
-		return
-	}
-
-	return
-}
-
-var staleCookiesErr = errors.New("Cookies are stale, but password had worked")
-
-func (ad *AuthData) Auth() (uploads *http.Response, err error) {
-	defer func() {
-		// on successful authorization
-		if err == nil || err == staleCookiesErr {
-			ad.saveCookies()
-		}
-	}()
-
-	if ad == nil {
-		return nil, errors.New("no auth data found")
-	}
-	if len(ad.Cookies) != 0 {
-		uploads, err = ad.Cookies.Auth()
-		if err == nil {
-			return
+func PerformAuth(ctx context.Context, oc *overcast.Client, args *CommonArgs) (uploads *overcast.UploadsPage, err error) {
+	var ad *overcast.AuthData
+	// auth with command line data
+	if args.Login != "" && args.Password != "" {
+		ad = &overcast.AuthData{
+			Creds: &overcast.Creds{
+				Email:    args.Login,
+				Password: args.Password,
+			},
 		}
-
-	}
-	if ad.Creds != nil {
-		uploads, err = ad.Creds.Auth()
+		uploads, err = oc.Auth(ctx, ad)
 		if err == nil {
-			if len(ad.Cookies) != 0 {
-				err = staleCookiesErr
+			if args.SaveCreds != nil && *args.SaveCreds {
+				saveCreds(ad)
 			}
 			return
+		} else {
+			fmt.Printf("[WARN] Failed to authenticate with supplied login/passowrd: %s\n", err)
 		}
 	}
-	return
-}
 
-func (ad *AuthData) saveCookies() {
-	cookies := client.Jar.Cookies(overcastURL)
-	ad.Cookies = make([]*BasicCookie, len(cookies))
-	for i, cookie := range cookies {
-		ad.Cookies[i] = &BasicCookie{
-			Name:  cookie.Name,
-			Value: cookie.Value,
+	// auth with cookies/saved password
+	if !args.NoLoadCreds {
+		ad = loadCreds()
+		if ad != nil {
+			uploads, err = oc.Auth(ctx, ad)
+			if err == overcast.ErrStaleCookies {
+				// refresh saved cookies
+				saveCreds(ad)
+				err = nil
+			}
+			if err == nil {
+				return
+			} else {
+				fmt.Printf("[WARN] Failed to authenticate with saved login/passowrd: %s\n", err)
+			}
 		}
 	}
-}
-
-func (ad *AuthData) GetCookies() []*http.Cookie {
-	res := make([]*http.Cookie, len(ad.Cookies))
 
-	for i, cookie := range ad.Cookies {
-		res[i] = &http.Cookie{
-			Name:  cookie.Name,
-			Value: cookie.Value,
+	// auth with input password
+	if !args.Silent {
+		ad = &overcast.AuthData{
+			Creds: inputCreds(),
+		}
+		if ad.Creds != nil {
+			uploads, err = oc.Auth(ctx, ad)
+			if err == nil {
+				if args.SaveCreds == nil {
+					// Ask to save
+					answer, err2 := Input("Do you want to store the email/password securely on your system? [y/N]: ")
+					if err2 != nil {
+						fmt.Printf("\n[WARN] Failed to get answer: %s\n", err2)
+						return
+					}
+
+					if len(answer) >= 1 && (answer[0] == 'Y' || answer[0] == 'y') {
+						saveCreds(ad)
+					}
+				} else {
+					if *args.SaveCreds {
+						saveCreds(ad)
+					}
+				}
+				return
+			} else {
+				fmt.Printf("[WARN] Failed to authenticate with entered login/passowrd: %s\n", err)
+			}
 		}
 	}
-
-	return res
-}
-
-func ParseAuthData(data []byte) (res *AuthData, err error) {
-	res = &AuthData{}
-	err = json.Unmarshal(data, &res)
+	uploads = nil
+	err = errors.New("all availible methods failed")
 	return
 }
 
-func inputCreds() (creds *Creds) {
-	creds = &Creds{}
+func inputCreds() (creds *overcast.Creds) {
+	creds = &overcast.Creds{}
 	var err error
 	creds.Email, err = Input("Email: ")
 	if err != nil {
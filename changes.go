@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Andrew-Morozko/cloudy-uploader/overcast"
+	"github.com/pkg/errors"
+)
+
+// The actions for the files that change while they're uploaded
+const (
+	ChangeRetry = "retry"
+	ChangeFail  = "fail"
+)
+
+// stableTime is how long a changed file has to stay the same before it's
+// uploaded again, a recorder still writing it changes it more often
+var stableTime = 10 * time.Second
+
+// changeRetries is how many times a changed file is uploaded again, a file
+// that changes after it was stable for stableTime is likely to keep changing
+const changeRetries = 1
+
+// waitStable waits until the file stops changing
+func waitStable(ctx context.Context, file string) (os.FileInfo, error) {
+	last, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		timer := time.NewTimer(stableTime)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+		stat, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		if stat.Size() == last.Size() && stat.ModTime().Equal(last.ModTime()) {
+			return stat, nil
+		}
+		last = stat
+	}
+}
+
+// uploadChanging uploads the file, retrying it once it's stable if it
+// changes during the upload, up to changeRetries times. Only the files uploaded as they are can be
+// retried, the prepared ones are temporary copies.
+func (job *Job) uploadChanging(ctx context.Context, uploader *overcast.Uploader, args *UploadArgs) error {
+	for changes := 0; ; changes++ {
+		err := job.uploadFileOnce(ctx, uploader, args)
+		var changed *overcast.FileChangedError
+		if err == nil || !errors.As(err, &changed) ||
+			args.OnChange != ChangeRetry || job.uploadFile != "" || changes >= changeRetries {
+			return err
+		}
+
+		job.uploadStatus.SetStatus("Changed, waiting @ ")
+		stat, err := waitStable(ctx, job.File)
+		if err != nil {
+			return err
+		}
+		err = checkAudio(job.File, stat.Size())
+		if err != nil {
+			return errors.WithMessage(err, "the file has changed")
+		}
+		job.FileSize = stat.Size()
+		job.uploadSize = stat.Size()
+		job.sha256 = ""
+		job.sizeStatus.SetStatus(formatSize(job.uploadSize))
+		job.uploadStatus.SetStatus(fmt.Sprintf("Changed %d/%d @ ", changes+1, changeRetries))
+	}
+}
+
+// uploadFileOnce uploads the file as it is now, with the hash checked if
+// --check-hash is set
+func (job *Job) uploadFileOnce(ctx context.Context, uploader *overcast.Uploader, args *UploadArgs) (err error) {
+	var hash string
+	if args.CheckHash {
+		if job.uploadFile == "" {
+			hash, err = job.SHA256()
+		} else {
+			hash, err = hashFile(job.uploadFile)
+		}
+		if err != nil {
+			return
+		}
+	}
+	f := &overcast.File{
+		Path:     job.UploadFile(),
+		Name:     job.FileName,
+		Size:     job.UploadSize(),
+		SHA256:   hash,
+		Verify:   args.Verify,
+		Progress: job.trackUpload,
+		OnRetry: func(retry int, delay time.Duration, err error) {
+			job.uploadStatus.SetStatus(fmt.Sprintf("Retry %d/%d @ ", retry, uploader.Retry.MaxAttempts-1))
+		},
+		OnRefresh: func() {
+			job.uploadStatus.SetStatus("New form @ ")
+		},
+	}
+	err = uploader.Upload(ctx, f)
+	job.key = f.Key
+	return
+}
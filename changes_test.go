@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Andrew-Morozko/cloudy-uploader/overcasttest"
+)
+
+// appendFrame adds an mp3 frame to the file, like a recorder still writing it
+func appendFrame(t *testing.T, path string) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer f.Close()
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x64})
+	if _, err = f.Write(frame); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUploadChangingFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		flags    []string
+		changes  int32
+		uploads  int32
+		uploaded bool
+	}{
+		{"changed once", nil, 1, 2, true},
+		{"keeps changing", nil, 100, 1 + changeRetries, false},
+		{"fail on change", []string{"--on-change", "fail"}, 1, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useConfigDir(t)
+			fastDelays(t)
+			srv := overcasttest.NewServer()
+			defer srv.Close()
+
+			path, _ := writeMP3(t, t.TempDir(), "live.mp3", 20)
+			var uploads int32
+			srv.OnUpload = func(key string) {
+				// the file changes while it's sent
+				if atomic.AddInt32(&uploads, 1) <= tt.changes {
+					appendFrame(t, path)
+				}
+			}
+			err := runCLI(srv, append([]string{path, "--retries", "5"}, tt.flags...)...)
+			if got := atomic.LoadInt32(&uploads); got != tt.uploads {
+				t.Errorf("uploaded %d times, want %d", got, tt.uploads)
+			}
+
+			key := srv.KeyPrefix + "live.mp3"
+			if !tt.uploaded {
+				if err == nil || !strings.Contains(err.Error(), "1 of 1 uploads failed") {
+					t.Errorf("got %v, want the upload to fail", err)
+				}
+				if len(srv.Submitted()) != 0 {
+					t.Errorf("submitted %v", srv.Submitted())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored, _ := srv.Object(key); !bytes.Equal(stored, data) {
+				t.Errorf("stored %d bytes, want the changed file of %d", len(stored), len(data))
+			}
+			if len(srv.Submitted()) != 1 {
+				t.Errorf("submitted %v", srv.Submitted())
+			}
+			history, err := OpenHistory()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entries := history.Entries(""); len(entries) != 1 || entries[0].Size != int64(len(data)) {
+				t.Errorf("history %+v", entries)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Andrew-Morozko/cloudy-uploader/media"
+	"github.com/Andrew-Morozko/cloudy-uploader/overcast"
+	"github.com/vbauerster/mpb/v4/decor"
+)
+
+// naturalLess compares the strings treating the runs of digits as numbers,
+// so "part 2" goes before "part 10"
+func naturalLess(a, b string) bool {
+	isDigit := func(c byte) bool { return '0' <= c && c <= '9' }
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			i, k := 0, 0
+			for i < len(a) && isDigit(a[i]) {
+				i++
+			}
+			for k < len(b) && isDigit(b[k]) {
+				k++
+			}
+			numA := strings.TrimLeft(a[:i], "0")
+			numB := strings.TrimLeft(b[:k], "0")
+			if len(numA) != len(numB) {
+				return len(numA) < len(numB)
+			}
+			if numA != numB {
+				return numA < numB
+			}
+			a, b = a[i:], b[k:]
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+// episodeTags are the tags of the first file that describe the joined episode.
+// The title names only the first part and the technical tags, like the
+// encoder or the track number, don't apply to the result.
+var episodeTags = []string{"album", "artist", "comment", "date", "genre"}
+
+// episodeMetadata returns the episodeTags of the tags.
+func episodeMetadata(tags map[string]string) map[string]string {
+	metadata := make(map[string]string)
+	for _, key := range episodeTags {
+		if value, ok := tags[key]; ok {
+			metadata[key] = value
+		}
+	}
+	return metadata
+}
+
+// concatFiles plans the job joining the files into one episode with a chapter
+// for every file. Audio is copied if the files have the same format, otherwise
+// it's encoded in the --transcode-format. Returns nil if there is nothing to
+// upload.
+func concatFiles(ctx context.Context, files []string, overcastParams *overcast.Params, prepArgs *PrepareArgs) *Job {
+	files = append([]string(nil), files...)
+	sort.SliceStable(files, func(i, k int) bool {
+		return naturalLess(files[i], files[k])
+	})
+
+	var (
+		inputs   []string
+		infos    []*media.Info
+		sizes    []int64
+		reencode bool
+	)
+	allowedList := allowedExts(overcastParams)
+	for _, file := range files {
+		allowed := allowedList.Inclues(filepath.Ext(file))
+		if !allowed {
+			if !prepArgs.Transcode {
+				fmt.Printf("[WARN] File \"%s\" is not allowed. Allowed extentions: %s\n", file, strings.Join(allowedList, ", "))
+				continue
+			}
+			reencode = true
+		}
+		stat, err := os.Stat(file)
+		if err != nil {
+			if os.IsNotExist(err) {
+				fmt.Printf("[WARN] File \"%s\" doesn't exist\n", file)
+			} else {
+				fmt.Printf("[WARN] Error with file \"%s\": %s\n", file, err)
+			}
+			continue
+		}
+		if allowed {
+			if err = checkAudio(file, stat.Size()); err != nil {
+				fmt.Printf("[WARN] File \"%s\" %s\n", file, err)
+				continue
+			}
+		}
+		info, err := media.Probe(ctx, file)
+		if err != nil {
+			fmt.Printf("[WARN] Failed to read \"%s\": %s\n", file, err)
+			continue
+		}
+		inputs = append(inputs, file)
+		infos = append(infos, info)
+		sizes = append(sizes, stat.Size())
+	}
+	if len(inputs) == 0 {
+		return nil
+	}
+
+	ext := strings.ToLower(filepath.Ext(inputs[0]))
+	for i, info := range infos {
+		first := infos[0]
+		if info.Codec != first.Codec || info.SampleRate != first.SampleRate ||
+			info.Channels != first.Channels || strings.ToLower(filepath.Ext(inputs[i])) != ext {
+			reencode = true
+		}
+	}
+
+	prep := &Preparation{Concat: inputs}
+	var totalSize int64
+	var start time.Duration
+	for i, info := range infos {
+		title := info.Tags["title"]
+		if title == "" {
+			title = strings.TrimSuffix(filepath.Base(inputs[i]), filepath.Ext(inputs[i]))
+		}
+		prep.Chapters = append(prep.Chapters, media.Chapter{
+			Start: start,
+			End:   start + info.Duration,
+			Title: title,
+		})
+		start += info.Duration
+		totalSize += sizes[i]
+	}
+	prep.Metadata = episodeMetadata(infos[0].Tags)
+
+	name := prepArgs.ConcatName
+	if name == "" {
+		name = filepath.Base(inputs[0])
+	}
+	if reencode {
+		prep.ConcatFormat = prepArgs.TranscodeFormat
+		ext = "." + prep.ConcatFormat
+	}
+	name = strings.TrimSuffix(name, filepath.Ext(name)) + ext
+	if !media.CanEmbed(name) {
+		fmt.Printf("[WARN] Joined file \"%s\" can't hold chapters, they are skipped\n", name)
+	}
+
+	job := NewJob(inputs[0], sizes[0])
+	job.FileName = name
+	job.Prep = prep
+	job.uploadSize = -1
+	if !reencode {
+		job.uploadSize = totalSize
+		if overcastParams.MaxFileSize >= 0 && totalSize > overcastParams.MaxFileSize {
+			fmt.Printf(
+				"[WARN] Joined file \"%s\" would be too large: file size=% .2f, max file size=% .2f\n",
+				name, decor.SizeB1000(totalSize), decor.SizeB1000(overcastParams.MaxFileSize),
+			)
+			return nil
+		}
+	}
+	fmt.Printf("Joining %d files into \"%s\"\n", len(inputs), name)
+	return job
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestNaturalLess(t *testing.T) {
+	files := []string{"part 10.mp3", "part 2.mp3", "part 1b.mp3", "Part 3.mp3", "part 01.mp3", "part.mp3", "part 1.mp3"}
+	want := []string{"Part 3.mp3", "part 01.mp3", "part 1.mp3", "part 1b.mp3", "part 2.mp3", "part 10.mp3", "part.mp3"}
+	sort.SliceStable(files, func(i, k int) bool {
+		return naturalLess(files[i], files[k])
+	})
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("got %q, want %q", files, want)
+	}
+}
+
+func TestEpisodeMetadata(t *testing.T) {
+	tags := map[string]string{
+		"title":        "Part 1",
+		"album":        "The Show",
+		"artist":       "Someone",
+		"comment":      "Notes",
+		"date":         "2020",
+		"genre":        "Podcast",
+		"track":        "1/3",
+		"encoder":      "Lavf58.29.100",
+		"major_brand":  "M4A ",
+		"itunsmpb":     "00000000 00000840",
+		"compilation":  "1",
+		"album_artist": "Someone Else",
+	}
+	want := map[string]string{
+		"album":   "The Show",
+		"artist":  "Someone",
+		"comment": "Notes",
+		"date":    "2020",
+		"genre":   "Podcast",
+	}
+	if got := episodeMetadata(tags); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := episodeMetadata(nil); len(got) != 0 {
+		t.Errorf("got %v for no tags", got)
+	}
+}
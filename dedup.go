@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/Andrew-Morozko/cloudy-uploader/overcast"
+	"github.com/vbauerster/mpb/v4/decor"
+)
+
+// Actions for the files that are already uploaded, see --on-duplicate
+const (
+	DuplicateAsk       = "ask"
+	DuplicateSkip      = "skip"
+	DuplicateOverwrite = "overwrite"
+	DuplicateRename    = "rename"
+)
+
+// findUpload returns the upload with the name, the sizes are compared only
+// if both are known and as precisely as the listing shows them.
+func findUpload(uploads []*overcast.Upload, name string, size int64) *overcast.Upload {
+	for _, upload := range uploads {
+		if upload.Name != name {
+			continue
+		}
+		if !upload.SizeMatches(size) {
+			continue
+		}
+		return upload
+	}
+	return nil
+}
+
+// expectedSize returns the size the upload of the job is going to have, -1
+// if it isn't known until the file is prepared. The tags and the artwork
+// only add about the size of the image.
+func expectedSize(job *Job) int64 {
+	prep := job.Prep
+	if prep == nil {
+		return job.FileSize
+	}
+	if prep.Length != 0 || prep.Transcode != nil || len(prep.Concat) != 0 || prep.Normalize != 0 {
+		return -1
+	}
+	return job.UploadSize()
+}
+
+// findDuplicate returns the upload of the same file as the job. It's found
+// by name, also the one it had before it was made safe for the storage, or,
+// if the file was renamed since, by its hash in the history.
+func findDuplicate(job *Job, uploads []*overcast.Upload, history []*HistoryEntry) *overcast.Upload {
+	size := expectedSize(job)
+	names := []string{job.FileName}
+	if job.unsafeName != "" {
+		names = append(names, job.unsafeName)
+	}
+	for _, name := range names {
+		if upload := findUpload(uploads, name, size); upload != nil {
+			return upload
+		}
+		if size >= 0 && size != job.FileSize {
+			// uploaded before without the new tags or the artwork
+			if upload := findUpload(uploads, name, job.FileSize); upload != nil {
+				return upload
+			}
+		}
+	}
+	if job.Prep != nil && (job.Prep.Length != 0 || len(job.Prep.Concat) != 0) {
+		// all the parts of a file have its hash, the joined file has the
+		// hash of its first part
+		return nil
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		entry := history[i]
+		// only hash the files that could match
+		if entry.SHA256 == "" || entry.Size != job.FileSize {
+			continue
+		}
+		hash, err := job.SHA256()
+		if err != nil {
+			return nil
+		}
+		if hash != entry.SHA256 {
+			continue
+		}
+		// the upload could have been deleted from the account since
+		if upload := findUpload(uploads, entry.Name, entry.uploadedSize()); upload != nil {
+			return upload
+		}
+	}
+	return nil
+}
+
+// uniqueName appends a number to the name until it's not taken
+func uniqueName(name string, taken map[string]bool) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 2; ; i++ {
+		newName := fmt.Sprintf("%s (%d)%s", base, i, ext)
+		if !taken[keyFold(newName)] {
+			return newName
+		}
+	}
+}
+
+func askDuplicate(job *Job, upload *overcast.Upload) string {
+	details := ""
+	if upload.Size >= 0 {
+		details = fmt.Sprintf(", % .2f", decor.SizeB1000(upload.Size))
+	}
+	if !upload.Date.IsZero() {
+		details += ", uploaded " + upload.Date.Format("2006-01-02")
+	}
+	if upload.Name != job.FileName {
+		details = fmt.Sprintf(" as \"%s\"%s", upload.Name, details)
+	}
+	for {
+		answer, err := Input(fmt.Sprintf(
+			"File \"%s\" is already uploaded%s. [s]kip, [o]verwrite or [r]ename? [S/o/r]: ",
+			job.FileName, details,
+		))
+		if err != nil {
+			fmt.Printf("[WARN] Failed to get answer, skipping: %s\n", err)
+			return DuplicateSkip
+		}
+		switch strings.ToLower(answer) {
+		case "", "s", "skip":
+			return DuplicateSkip
+		case "o", "overwrite":
+			return DuplicateOverwrite
+		case "r", "rename":
+			return DuplicateRename
+		}
+	}
+}
+
+// dedup applies --on-duplicate to the jobs that are already uploaded.
+// Skipped jobs are removed, renamed jobs get a free name, the uploads
+// that should be overwritten are returned to be deleted before the upload.
+func (args *Args) dedup(jobs []*Job, uploads []*overcast.Upload, history []*HistoryEntry) (kept []*Job, overwritten map[*Job]*overcast.Upload) {
+	overwritten = make(map[*Job]*overcast.Upload)
+	uploaded := make(map[string]bool)
+	taken := make(map[string]bool)
+	for _, upload := range uploads {
+		uploaded[upload.Name] = true
+		taken[keyFold(upload.Name)] = true
+	}
+	for _, job := range jobs {
+		taken[keyFold(job.FileName)] = true
+	}
+
+	for _, job := range jobs {
+		upload := findDuplicate(job, uploads, history)
+		if upload == nil {
+			kept = append(kept, job)
+			continue
+		}
+
+		action := args.OnDuplicate
+		if action == DuplicateAsk {
+			action = askDuplicate(job, upload)
+		}
+		switch action {
+		case DuplicateSkip:
+			if upload.Name != job.FileName {
+				fmt.Printf("Skipping \"%s\", it's already uploaded as \"%s\"\n", job.File, upload.Name)
+			} else {
+				fmt.Printf("Skipping \"%s\", it's already uploaded\n", job.File)
+			}
+			continue
+		case DuplicateOverwrite:
+			overwritten[job] = upload
+		case DuplicateRename:
+			if !uploaded[job.FileName] {
+				// found by hash or by the unsafe name, the name is
+				// already different
+				break
+			}
+			newName := uniqueName(job.FileName, taken)
+			taken[keyFold(newName)] = true
+			fmt.Printf("\"%s\" is already uploaded, uploading it as \"%s\"\n", job.File, newName)
+			job.FileName = newName
+		}
+		kept = append(kept, job)
+	}
+	return
+}
+
+// freedLimits returns the account limits as if the overwritten uploads
+// were already deleted
+func freedLimits(params *overcast.Params, overwritten map[*Job]*overcast.Upload) *overcast.Params {
+	freed := *params
+	for _, upload := range overwritten {
+		if freed.MaxFileCount >= 0 {
+			freed.MaxFileCount++
+		}
+		if freed.SpaceAvailable >= 0 && upload.Size >= 0 {
+			freed.SpaceAvailable += upload.Size
+		}
+	}
+	return &freed
+}
+
+// deleteOverwritten deletes the uploads replaced by the jobs, the jobs whose
+// uploads can't be deleted are dropped so they don't end up uploaded twice
+func deleteOverwritten(ctx context.Context, oc *overcast.Client, jobs []*Job, overwritten map[*Job]*overcast.Upload) (kept []*Job) {
+	for _, job := range jobs {
+		upload, found := overwritten[job]
+		if !found {
+			kept = append(kept, job)
+			continue
+		}
+		err := oc.Delete(ctx, upload)
+		if err != nil {
+			fmt.Printf("[WARN] Failed to delete the old \"%s\", skipping the file: %s\n", upload.Name, err)
+			continue
+		}
+		kept = append(kept, job)
+	}
+	return
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Andrew-Morozko/cloudy-uploader/media"
+	"github.com/Andrew-Morozko/cloudy-uploader/overcast"
+)
+
+func TestUniqueName(t *testing.T) {
+	tests := []struct {
+		name  string
+		taken []string
+		want  string
+	}{
+		{"ep1.mp3", []string{"ep1.mp3"}, "ep1 (2).mp3"},
+		{"ep1.mp3", []string{"ep1.mp3", "EP1 (2).MP3"}, "ep1 (3).mp3"},
+		{"notes", []string{"notes"}, "notes (2)"},
+		{"a.b.m4a", []string{"a.b.m4a"}, "a.b (2).m4a"},
+	}
+	for _, tt := range tests {
+		taken := make(map[string]bool)
+		for _, name := range tt.taken {
+			taken[keyFold(name)] = true
+		}
+		if got := uniqueName(tt.name, taken); got != tt.want {
+			t.Errorf("uniqueName(%q, %v) = %q, want %q", tt.name, tt.taken, got, tt.want)
+		}
+	}
+}
+
+func TestFindUpload(t *testing.T) {
+	uploads := []*overcast.Upload{
+		{Name: "ep1.mp3", Size: 1000},
+		{Name: "ep2.mp3", Size: -1},
+	}
+	tests := []struct {
+		name string
+		size int64
+		want *overcast.Upload
+	}{
+		{"ep1.mp3", 1000, uploads[0]},
+		{"ep1.mp3", -1, uploads[0]},
+		{"ep1.mp3", 2000, nil},
+		{"ep2.mp3", 5, uploads[1]},
+		{"EP1.mp3", 1000, nil},
+		{"ep3.mp3", -1, nil},
+	}
+	for _, tt := range tests {
+		if got := findUpload(uploads, tt.name, tt.size); got != tt.want {
+			t.Errorf("findUpload(%q, %d) = %+v, want %+v", tt.name, tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestFindDuplicateBySize(t *testing.T) {
+	uploads := []*overcast.Upload{
+		{Name: "plain.mp3", Size: 1000},
+		{Name: "tagged.mp3", Size: 1300},
+		{Name: "untagged.mp3", Size: 1000},
+		{Name: "cut.mp3", Size: 1000},
+	}
+	tests := []struct {
+		name       string
+		size       int64
+		prep       *Preparation
+		uploadSize int64
+		want       *overcast.Upload
+	}{
+		{"plain.mp3", 1000, nil, 1000, uploads[0]},
+		{"plain.mp3", 2000, nil, 2000, nil},
+		// the artwork adds 300 bytes
+		{"tagged.mp3", 1000, &Preparation{Artwork: "cover.jpg"}, 1300, uploads[1]},
+		{"untagged.mp3", 1000, &Preparation{Artwork: "cover.jpg"}, 1300, uploads[2]},
+		{"tagged.mp3", 5000, &Preparation{Artwork: "cover.jpg"}, 5300, nil},
+		{"tagged.mp3", 5000, &Preparation{Tags: map[string]string{"album": "A"}}, 5000, nil},
+		// the size changes in unknown ways
+		{"cut.mp3", 5000, &Preparation{Length: time.Minute}, 2500, uploads[3]},
+		{"cut.mp3", 5000, &Preparation{Transcode: media.Command{"ffmpeg"}}, -1, uploads[3]},
+		{"cut.mp3", 5000, &Preparation{Concat: []string{"a.mp3", "b.mp3"}}, 8000, uploads[3]},
+		{"cut.mp3", 5000, &Preparation{Normalize: -16}, -1, uploads[3]},
+	}
+	for _, tt := range tests {
+		job := NewJob("/podcasts/"+tt.name, tt.size)
+		job.Prep = tt.prep
+		job.uploadSize = tt.uploadSize
+		if got := findDuplicate(job, uploads, nil); got != tt.want {
+			t.Errorf("%s of %d bytes, prepared %+v: got %+v, want %+v", tt.name, tt.size, tt.prep, got, tt.want)
+		}
+	}
+}
+
+func TestFindDuplicateUnsafeName(t *testing.T) {
+	uploads := []*overcast.Upload{
+		{Name: "Q&A #3.mp3", Size: 1000},
+		{Name: "Show [live].mp3", Size: 1000},
+	}
+	tests := []struct {
+		file string
+		size int64
+		want *overcast.Upload
+	}{
+		{"/podcasts/Q&A #3.mp3", 1000, uploads[0]},
+		{"/podcasts/Show [live].mp3", 1000, uploads[1]},
+		{"/podcasts/Show [live].mp3", 2000, nil},
+		{"/podcasts/Show _live_.mp3", 1000, nil},
+	}
+	for _, tt := range tests {
+		job := NewJob(tt.file, tt.size)
+		if err := resolveCollisions([]*Job{job}, CollisionNumber); err != nil {
+			t.Fatal(err)
+		}
+		if got := findDuplicate(job, uploads, nil); got != tt.want {
+			t.Errorf("%s uploaded as %s: got %+v, want %+v", tt.file, job.FileName, got, tt.want)
+		}
+	}
+
+	// renamed only if it's uploaded under the safe name
+	args := &Args{OnDuplicate: DuplicateRename}
+	job := NewJob("/podcasts/Q&A #3.mp3", 1000)
+	if err := resolveCollisions([]*Job{job}, CollisionNumber); err != nil {
+		t.Fatal(err)
+	}
+	kept, _ := args.dedup([]*Job{job}, uploads, nil)
+	if len(kept) != 1 || kept[0].FileName != "Q&A _3.mp3" {
+		t.Errorf("kept %+v", kept)
+	}
+}
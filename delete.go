@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/Andrew-Morozko/cloudy-uploader/overcast"
+	"github.com/pkg/errors"
+	"github.com/vbauerster/mpb/v4/decor"
+)
+
+type DeleteArgs struct {
+	Names []string `arg:"positional" placeholder:"NAME" help:"names or glob patterns of the files to delete"`
+	CommonArgs
+	OlderThan string `arg:"--older-than" help:"only delete files uploaded before the date (2006-01-02) or longer ago than the age (30d, 2w, 12h)" placeholder:"DATE|AGE"`
+	Yes       bool   `arg:"-y,--yes" help:"don't ask for confirmation"`
+	DryRun    bool   `arg:"-n,--dry-run" help:"only list the files that would be deleted"`
+
+	olderThan time.Time
+}
+
+func (DeleteArgs) Description() string {
+	return `Deletes the uploaded files from the Overcast account.
+Files are selected by exact name or glob pattern (quote it from the shell),
+and/or by the upload date.
+`
+}
+
+// parseOlderThan parses a date or an age like 30d, 2w or 12h
+func parseOlderThan(s string, now time.Time) (time.Time, error) {
+	if date, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return date, nil
+	}
+	if len(s) > 1 {
+		if n, err := strconv.Atoi(s[:len(s)-1]); err == nil && n >= 0 {
+			switch s[len(s)-1] {
+			case 'd':
+				return now.AddDate(0, 0, -n), nil
+			case 'w':
+				return now.AddDate(0, 0, -7*n), nil
+			}
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, errors.Errorf("invalid --older-than %q: expected a date like 2006-01-02 or an age like 30d", s)
+}
+
+func (args *DeleteArgs) Validate() (err error) {
+	if len(args.Names) == 0 && args.OlderThan == "" {
+		return errors.New("specify the names of the files to delete and/or --older-than")
+	}
+	for _, pattern := range args.Names {
+		if _, err = path.Match(pattern, ""); err != nil {
+			return errors.Errorf("invalid pattern %q", pattern)
+		}
+	}
+	if args.OlderThan != "" {
+		args.olderThan, err = parseOlderThan(args.OlderThan, time.Now())
+	}
+	if args.Silent && !args.Yes && !args.DryRun {
+		return errors.New("--silent requires --yes or --dry-run")
+	}
+	return
+}
+
+// matches reports whether the upload is selected for deletion
+func (args *DeleteArgs) matches(upload *overcast.Upload) bool {
+	if len(args.Names) != 0 {
+		nameMatches := false
+		for _, pattern := range args.Names {
+			if ok, _ := path.Match(pattern, upload.Name); ok || pattern == upload.Name {
+				nameMatches = true
+				break
+			}
+		}
+		if !nameMatches {
+			return false
+		}
+	}
+	if !args.olderThan.IsZero() {
+		return !upload.Date.IsZero() && upload.Date.Before(args.olderThan)
+	}
+	return true
+}
+
+// Run deletes the selected uploads.
+func (args *DeleteArgs) Run(ctx context.Context) (err error) {
+	oc, upl, err := login(ctx, &args.CommonArgs)
+	if err != nil {
+		return
+	}
+
+	var selected []*overcast.Upload
+	var unknownDates int
+	for _, upload := range upl.Uploads() {
+		if upload.Date.IsZero() {
+			unknownDates++
+		}
+		if args.matches(upload) {
+			selected = append(selected, upload)
+		}
+	}
+	if !args.olderThan.IsZero() && unknownDates != 0 {
+		fmt.Printf("[WARN] Upload date of %d files is unknown, they are never deleted by --older-than\n", unknownDates)
+	}
+
+	if len(selected) == 0 {
+		fmt.Println("No matching files found")
+		return nil
+	}
+
+	if args.DryRun {
+		fmt.Fprintln(stdout, "Would delete:")
+	} else {
+		fmt.Println("Going to delete:")
+	}
+	for _, upload := range selected {
+		size := "?"
+		if upload.Size >= 0 {
+			size = fmt.Sprintf("% .1f", decor.SizeB1000(upload.Size))
+		}
+		date := "?"
+		if !upload.Date.IsZero() {
+			date = upload.Date.Format("2006-01-02")
+		}
+		line := fmt.Sprintf("  %s (%s, uploaded %s)", upload.Name, size, date)
+		if args.DryRun {
+			fmt.Fprintln(stdout, line)
+		} else {
+			fmt.Println(line)
+		}
+	}
+	if args.DryRun {
+		return nil
+	}
+
+	if !args.Yes {
+		answer, err := Input(fmt.Sprintf("Delete %d files? [y/N]: ", len(selected)))
+		if err != nil {
+			return errors.WithMessage(err, "Failed to get answer")
+		}
+		if len(answer) == 0 || (answer[0] != 'Y' && answer[0] != 'y') {
+			fmt.Println("Nothing deleted")
+			return nil
+		}
+	}
+
+	var failed int
+	for _, upload := range selected {
+		err = oc.Delete(ctx, upload)
+		if err != nil {
+			failed++
+			fmt.Printf("[WARN] Failed to delete \"%s\": %s\n", upload.Name, err)
+			continue
+		}
+		fmt.Printf("Deleted \"%s\"\n", upload.Name)
+	}
+	if failed != 0 {
+		return errors.Errorf("%d of %d files weren't deleted", failed, len(selected))
+	}
+	return nil
+}
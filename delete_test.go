@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Andrew-Morozko/cloudy-uploader/overcast"
+)
+
+func TestParseOlderThan(t *testing.T) {
+	now := time.Date(2021, 3, 31, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{in: "2021-01-31", want: time.Date(2021, 1, 31, 0, 0, 0, 0, time.Local)},
+		{in: "30d", want: time.Date(2021, 3, 1, 12, 0, 0, 0, time.Local)},
+		{in: "0d", want: now},
+		{in: "2w", want: time.Date(2021, 3, 17, 12, 0, 0, 0, time.Local)},
+		{in: "12h", want: time.Date(2021, 3, 31, 0, 0, 0, 0, time.Local)},
+		{in: "1h30m", want: time.Date(2021, 3, 31, 10, 30, 0, 0, time.Local)},
+		{in: "", wantErr: true},
+		{in: "d", wantErr: true},
+		{in: "-3d", wantErr: true},
+		{in: "-1h", wantErr: true},
+		{in: "3y", wantErr: true},
+		{in: "1.5d", wantErr: true},
+		{in: "2021-02-30", wantErr: true},
+		{in: "31/01/2021", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseOlderThan(tt.in, now)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseOlderThan(%q): error %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parseOlderThan(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDeleteMatches(t *testing.T) {
+	cutoff := time.Date(2021, 1, 1, 0, 0, 0, 0, time.Local)
+	old := &overcast.Upload{Name: "ep1.mp3", Date: cutoff.AddDate(0, -1, 0)}
+	recent := &overcast.Upload{Name: "ep2.m4a", Date: cutoff.AddDate(0, 1, 0)}
+	undated := &overcast.Upload{Name: "ep[3].mp3"}
+	tests := []struct {
+		name  string
+		args  DeleteArgs
+		match []bool
+	}{
+		{"glob", DeleteArgs{Names: []string{"*.mp3"}}, []bool{true, false, true}},
+		{"literal brackets", DeleteArgs{Names: []string{"ep[3].mp3"}}, []bool{false, false, true}},
+		{"older than", DeleteArgs{olderThan: cutoff}, []bool{true, false, false}},
+		{"both", DeleteArgs{Names: []string{"*.m4a"}, olderThan: cutoff}, []bool{false, false, false}},
+	}
+	for _, tt := range tests {
+		for i, upload := range []*overcast.Upload{old, recent, undated} {
+			if got := tt.args.matches(upload); got != tt.match[i] {
+				t.Errorf("%s: matches(%q) = %v, want %v", tt.name, upload.Name, got, tt.match[i])
+			}
+		}
+	}
+}
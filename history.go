@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Andrew-Morozko/cloudy-uploader/overcast"
+	"github.com/pkg/errors"
+	"github.com/vbauerster/mpb/v4/decor"
+)
+
+// HistoryEntry is a file submitted to Overcast.
+type HistoryEntry struct {
+	// Site is the base URL of the Overcast website
+	Site string `json:"site"`
+	// File is the absolute path of the uploaded file
+	File string `json:"file"`
+	// Name is the name of the file on Overcast
+	Name string `json:"name"`
+	Key  string `json:"key"`
+	// Size is the size of File
+	Size int64 `json:"size"`
+	// UploadSize is the size of the uploaded file if it differs from Size,
+	// like for the prepared files
+	UploadSize int64 `json:"upload_size,omitempty"`
+	// SHA256 is the hex encoded hash of the file contents, empty if the file
+	// couldn't be read or the upload isn't the file, like a joined file
+	SHA256    string    `json:"sha256,omitempty"`
+	Submitted time.Time `json:"submitted"`
+}
+
+// uploadedSize returns the size of the uploaded file
+func (entry *HistoryEntry) uploadedSize() int64 {
+	if entry.UploadSize != 0 {
+		return entry.UploadSize
+	}
+	return entry.Size
+}
+
+// newHistoryEntry returns the entry of the file submitted now, see
+// HistoryEntry
+func newHistoryEntry(site, key, name, file string, size, uploadSize int64, hash string) *HistoryEntry {
+	entry := &HistoryEntry{
+		Site:      site,
+		File:      absPath(file),
+		Name:      name,
+		Key:       key,
+		Size:      size,
+		SHA256:    hash,
+		Submitted: time.Now(),
+	}
+	if uploadSize > 0 && uploadSize != size {
+		entry.UploadSize = uploadSize
+	}
+	return entry
+}
+
+// History is the log of all the submitted files, one JSON entry per line.
+// Entries are only ever appended.
+type History struct {
+	path    string
+	lock    sync.Mutex
+	entries []*HistoryEntry
+	// cutShort is set if the last line has no newline, the next entry
+	// starts a new line
+	cutShort bool
+	// err is the last error encountered while saving the history
+	err error
+}
+
+// OpenHistory loads the history from the config folder.
+func OpenHistory() (*History, error) {
+	path, err := configFile("history.jsonl")
+	if err != nil {
+		return nil, err
+	}
+	h := &History{path: path}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		entry := &HistoryEntry{}
+		err = json.Unmarshal(data, entry)
+		if err != nil {
+			// a line could be cut short by a crash, keep the rest
+			continue
+		}
+		h.entries = append(h.entries, entry)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "can't read history %s", path)
+	}
+	if stat, err := f.Stat(); err == nil && stat.Size() != 0 {
+		last := make([]byte, 1)
+		if _, err = f.ReadAt(last, stat.Size()-1); err == nil {
+			h.cutShort = last[0] != '\n'
+		}
+	}
+	return h, nil
+}
+
+// Add records the submitted file. Does nothing on a nil history.
+func (h *History) Add(entry *HistoryEntry) {
+	if h == nil {
+		return
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.entries = append(h.entries, entry)
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		h.err = err
+		return
+	}
+	f, err := os.OpenFile(h.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		h.err = err
+		return
+	}
+	if h.cutShort {
+		data = append([]byte{'\n'}, data...)
+	}
+	_, err = f.Write(append(data, '\n'))
+	if err == nil {
+		h.cutShort = false
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		h.err = err
+	}
+}
+
+// Entries returns the files submitted to the site, oldest first.
+// All the entries are returned if the site is empty.
+func (h *History) Entries(site string) (entries []*HistoryEntry) {
+	if h == nil {
+		return nil
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for _, entry := range h.entries {
+		if site == "" || entry.Site == site {
+			entries = append(entries, entry)
+		}
+	}
+	return
+}
+
+// Err returns the last error encountered while saving the history.
+func (h *History) Err() error {
+	if h == nil {
+		return nil
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.err
+}
+
+// hashFile returns the hex encoded SHA-256 of the file contents
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	_, err = io.Copy(hash, f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+type HistoryArgs struct {
+	CommonArgs
+	All    bool   `arg:"--all" help:"show the uploads to all sites, not just --base-url"`
+	Format string `arg:"-f,--format" help:"output format: table, json or csv" default:"table"`
+}
+
+func (HistoryArgs) Description() string {
+	return `Shows the files uploaded from this computer, oldest first.
+`
+}
+
+func (args *HistoryArgs) Validate() error {
+	switch args.Format {
+	case "table", "json", "csv":
+		return nil
+	}
+	return errors.Errorf("unknown format %q", args.Format)
+}
+
+// Run prints the history, it doesn't need to log in.
+func (args *HistoryArgs) Run(ctx context.Context) (err error) {
+	history, err := OpenHistory()
+	if err != nil {
+		return errors.WithMessage(err, "Failed to open the history")
+	}
+
+	site := ""
+	if !args.All {
+		oc, err := overcast.NewClient(nil, args.BaseURL)
+		if err != nil {
+			return errors.WithMessage(err, "Arguments error")
+		}
+		site = oc.BaseURL.String()
+	}
+	entries := history.Entries(site)
+	if entries == nil {
+		entries = []*HistoryEntry{}
+	}
+
+	switch args.Format {
+	case "json":
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(entries)
+	case "csv":
+		w := csv.NewWriter(stdout)
+		w.Write([]string{"submitted", "name", "size", "sha256", "key", "file", "site"})
+		for _, entry := range entries {
+			w.Write([]string{
+				entry.Submitted.Format(time.RFC3339), entry.Name,
+				strconv.FormatInt(entry.Size, 10), entry.SHA256,
+				entry.Key, entry.File, entry.Site,
+			})
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SUBMITTED\tNAME\tSIZE\tSHA256\tFILE")
+	for _, entry := range entries {
+		hash := entry.SHA256
+		if len(hash) > 12 {
+			hash = hash[:12]
+		}
+		fmt.Fprintf(tw, "%s\t%s\t% .1f\t%s\t%s\n",
+			entry.Submitted.Local().Format("2006-01-02 15:04"), entry.Name,
+			decor.SizeB1000(entry.Size), hash, entry.File,
+		)
+	}
+	err = tw.Flush()
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(stdout, "\n%d files\n", len(entries))
+	return nil
+}
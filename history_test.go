@@ -0,0 +1,127 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Andrew-Morozko/cloudy-uploader/overcast"
+)
+
+func TestHistory(t *testing.T) {
+	useConfigDir(t)
+	history, err := OpenHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := history.Entries(""); len(entries) != 0 {
+		t.Fatalf("new history has %+v", entries)
+	}
+	history.Add(&HistoryEntry{Site: "a", Name: "ep1.mp3", Size: 100, SHA256: "01"})
+	history.Add(&HistoryEntry{Site: "b", Name: "ep2.mp3", Size: 200, UploadSize: 250})
+	if history.Err() != nil {
+		t.Fatal(history.Err())
+	}
+
+	history, err = OpenHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := history.Entries("")
+	if len(all) != 2 || all[0].Name != "ep1.mp3" || all[0].SHA256 != "01" || all[1].uploadedSize() != 250 {
+		t.Errorf("entries %+v", all)
+	}
+	if site := history.Entries("b"); len(site) != 1 || site[0].Name != "ep2.mp3" {
+		t.Errorf("site entries %+v", site)
+	}
+	if (*History)(nil).Entries("") != nil {
+		t.Error("nil history has entries")
+	}
+}
+
+func TestHistoryCorruptLines(t *testing.T) {
+	dir := useConfigDir(t)
+	path := filepath.Join(dir, "history.jsonl")
+	data := `{"site": "a", "name": "ep1.mp3", "size": 100}` + "\n" +
+		"not json\n" +
+		"\n" +
+		// cut short by a crash
+		`{"site": "a", "name": "ep2`
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := OpenHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := history.Entries(""); len(entries) != 1 || entries[0].Name != "ep1.mp3" {
+		t.Fatalf("entries %+v", entries)
+	}
+	history.Add(&HistoryEntry{Site: "a", Name: "ep3.mp3"})
+	history.Add(&HistoryEntry{Site: "a", Name: "ep4.mp3"})
+
+	history, err = OpenHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range history.Entries("a") {
+		names = append(names, entry.Name)
+	}
+	if len(names) != 3 || names[1] != "ep3.mp3" || names[2] != "ep4.mp3" {
+		t.Errorf("after appending to the cut line: %q", names)
+	}
+}
+
+func TestFindDuplicateInHistory(t *testing.T) {
+	dir := t.TempDir()
+	file, data := writeMP3(t, dir, "renamed.mp3", 10)
+	size := int64(len(data))
+	hash, err := hashFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploads := []*overcast.Upload{
+		{Name: "old.mp3", Size: size},
+		{Name: "tagged.mp3", Size: size + 300},
+	}
+
+	tests := []struct {
+		name    string
+		prep    *Preparation
+		history []*HistoryEntry
+		want    *overcast.Upload
+	}{
+		{"renamed", nil, []*HistoryEntry{{Name: "old.mp3", Size: size, SHA256: hash}}, uploads[0]},
+		{"other content", nil, []*HistoryEntry{{Name: "old.mp3", Size: size, SHA256: "00ff"}}, nil},
+		{"other size", nil, []*HistoryEntry{{Name: "old.mp3", Size: size + 1, SHA256: hash}}, nil},
+		{"deleted since", nil, []*HistoryEntry{{Name: "gone.mp3", Size: size, SHA256: hash}}, nil},
+		{"uploaded prepared", nil, []*HistoryEntry{{Name: "tagged.mp3", Size: size, UploadSize: size + 300, SHA256: hash}}, uploads[1]},
+		{"no hash", nil, []*HistoryEntry{{Name: "old.mp3", Size: size}}, nil},
+		{"latest first", nil, []*HistoryEntry{
+			{Name: "old.mp3", Size: size, SHA256: hash},
+			{Name: "tagged.mp3", Size: size, UploadSize: size + 300, SHA256: hash},
+		}, uploads[1]},
+		{"part", &Preparation{Length: time.Minute}, []*HistoryEntry{{Name: "old.mp3", Size: size, SHA256: hash}}, nil},
+		{"joined", &Preparation{Concat: []string{file, file}}, []*HistoryEntry{{Name: "old.mp3", Size: size, SHA256: hash}}, nil},
+	}
+	for _, tt := range tests {
+		job := NewJob(file, size)
+		job.FileName = "new.mp3"
+		job.Prep = tt.prep
+		if got := findDuplicate(job, uploads, tt.history); got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	// the hash is only computed for the entries of the same size
+	job := NewJob(filepath.Join(dir, "missing.mp3"), size+1)
+	if got := findDuplicate(job, uploads, []*HistoryEntry{{Name: "old.mp3", Size: size, SHA256: hash}}); got != nil {
+		t.Errorf("got %+v", got)
+	}
+	if job.sha256 != "" {
+		t.Error("the file of another size is hashed")
+	}
+}
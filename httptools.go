@@ -44,11 +44,3 @@ func NewHTTPClient() *http.Client {
 
 	return res
 }
-
-func URLMustParse(rawurl string) *url.URL {
-	url, err := url.Parse(rawurl)
-	if err != nil {
-		panic(err)
-	}
-	return url
-}
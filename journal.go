@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shibukawa/configdir"
+)
+
+// configDir returns the app's config folder, the tests use a temporary one
+var configDir = func() *configdir.Config {
+	return configdir.New("", appName).QueryFolders(configdir.Global)[0]
+}
+
+// configFile returns the path of the file in the app's config folder,
+// creating the folder if needed.
+func configFile(name string) (string, error) {
+	configDir := configDir()
+	err := configDir.MkdirAll()
+	if err != nil {
+		return "", errors.WithMessage(err, "can't create config folder")
+	}
+	return filepath.Join(configDir.Path, name), nil
+}
+
+// writeFileAtomic replaces the file at path, so it's never left half-written
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// JournalEntry is a file uploaded to S3, but not submitted to Overcast.
+// It has what the history needs once the file is submitted.
+type JournalEntry struct {
+	// Site is the base URL of the Overcast website
+	Site string
+	Key  string
+	// File and Size are the local file, like in HistoryEntry
+	File string
+	Size int64
+	// UploadSize is the size of the uploaded file, 0 if unknown
+	UploadSize int64 `json:",omitempty"`
+	// NoHash is set if the hash of File doesn't identify the upload
+	NoHash   bool `json:",omitempty"`
+	Uploaded time.Time
+}
+
+// Journal keeps track of the files uploaded to S3, but not yet submitted to
+// Overcast, so the submission could be retried by the resubmit command.
+type Journal struct {
+	path    string
+	lock    sync.Mutex
+	entries []*JournalEntry
+	// err is the last error encountered while saving the journal
+	err error
+}
+
+// OpenJournal loads the journal from the config folder.
+func OpenJournal() (*Journal, error) {
+	path, err := configFile("pending.json")
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{path: path}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &j.entries)
+	if err != nil {
+		return nil, errors.Wrapf(err, "corrupted journal %s", path)
+	}
+	return j, nil
+}
+
+func (j *Journal) save() {
+	data, err := json.MarshalIndent(j.entries, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(j.path, data)
+	}
+	if err != nil {
+		j.err = err
+	}
+}
+
+// Add records the file uploaded to S3. Does nothing on a nil journal.
+func (j *Journal) Add(entry *JournalEntry) {
+	if j == nil {
+		return
+	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.remove(entry.Site, entry.Key)
+	j.entries = append(j.entries, entry)
+	j.save()
+}
+
+// Remove forgets about the submitted file. Does nothing on a nil journal.
+func (j *Journal) Remove(site, key string) {
+	if j == nil {
+		return
+	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if j.remove(site, key) {
+		j.save()
+	}
+}
+
+func (j *Journal) remove(site, key string) (found bool) {
+	for i, entry := range j.entries {
+		if entry.Site == site && entry.Key == key {
+			j.entries = append(j.entries[:i], j.entries[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Has reports whether the upload is still waiting for the submission.
+func (j *Journal) Has(site, key string) bool {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	for _, entry := range j.entries {
+		if entry.Site == site && entry.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Pending returns the unsubmitted uploads to the site, oldest first.
+func (j *Journal) Pending(site string) (entries []*JournalEntry) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	for _, entry := range j.entries {
+		if entry.Site == site {
+			entries = append(entries, entry)
+		}
+	}
+	sort.SliceStable(entries, func(i, k int) bool {
+		return entries[i].Uploaded.Before(entries[k].Uploaded)
+	})
+	return
+}
+
+// Err returns the last error encountered while saving the journal.
+func (j *Journal) Err() error {
+	if j == nil {
+		return nil
+	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.err
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Andrew-Morozko/cloudy-uploader/media"
+)
+
+func TestJournal(t *testing.T) {
+	useConfigDir(t)
+	journal, err := OpenJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	journal.Add(&JournalEntry{Site: "a", Key: "k2", File: "/b.mp3", Uploaded: now})
+	journal.Add(&JournalEntry{Site: "a", Key: "k1", File: "/a.mp3", Uploaded: now.Add(-time.Minute)})
+	journal.Add(&JournalEntry{Site: "b", Key: "k1", File: "/c.mp3", Uploaded: now})
+	// uploaded again
+	journal.Add(&JournalEntry{Site: "a", Key: "k2", File: "/b.mp3", Size: 5, Uploaded: now})
+	if journal.Err() != nil {
+		t.Fatal(journal.Err())
+	}
+
+	journal, err = OpenJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, entry := range journal.Pending("a") {
+		keys = append(keys, entry.Key)
+	}
+	if want := []string{"k1", "k2"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("pending %v, want %v", keys, want)
+	}
+	if pending := journal.Pending("a"); pending[1].Size != 5 {
+		t.Errorf("the entry isn't replaced: %+v", pending[1])
+	}
+
+	journal.Remove("a", "k1")
+	journal.Remove("a", "missing")
+	journal, err = OpenJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if journal.Has("a", "k1") || !journal.Has("a", "k2") || !journal.Has("b", "k1") {
+		t.Errorf("after the removal %+v", journal.entries)
+	}
+}
+
+func TestJournalHistoryEntry(t *testing.T) {
+	dir := t.TempDir()
+	file, data := writeMP3(t, dir, "ep.mp3", 10)
+	size := int64(len(data))
+	tests := []struct {
+		name       string
+		prep       *Preparation
+		uploadSize int64
+		hashed     bool
+	}{
+		{"plain", nil, size, true},
+		{"tagged", &Preparation{Tags: map[string]string{"album": "A"}, Artwork: filepath.Join(dir, "cover.jpg")}, size + 300, true},
+		{"transcoded", &Preparation{Transcode: media.Command{"ffmpeg", "{in}", "{out}"}}, 2 * size, true},
+		{"joined", &Preparation{Concat: []string{file, file}}, 2 * size, false},
+		{"part", &Preparation{Start: time.Minute, Length: time.Minute}, size / 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := NewJob(file, size)
+			job.FileName = "episode.mp3"
+			job.Prep = tt.prep
+			job.uploadSize = tt.uploadSize
+
+			want := job.historyEntry("site", "uploads/episode.mp3")
+			got := job.journalEntry("site", "uploads/episode.mp3").historyEntry("episode.mp3")
+			got.Submitted = want.Submitted
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("resubmitted %+v, uploaded %+v", got, want)
+			}
+			if got.Size != size || (got.SHA256 != "") != tt.hashed {
+				t.Errorf("size %d, hash %q", got.Size, got.SHA256)
+			}
+			if got.uploadedSize() != tt.uploadSize {
+				t.Errorf("uploaded size %d, want %d", got.uploadedSize(), tt.uploadSize)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"golang.org/x/text/unicode/norm"
+)
+
+// The actions for the files of a batch that would get the same S3 key
+const (
+	CollisionFail   = "fail"
+	CollisionFolder = "folder"
+	CollisionNumber = "number"
+)
+
+// unsafeKeyChars are the characters S3 advises against in keys
+const unsafeKeyChars = "\\{}^%`[]\"<>~#|"
+
+// safeKeyName normalizes the name to NFC and replaces the characters that
+// aren't safe in S3 keys with "_"
+func safeKeyName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || strings.ContainsRune(unsafeKeyChars, r) || unicode.IsControl(r) {
+			return '_'
+		}
+		return r
+	}, norm.NFC.String(name))
+}
+
+// keyFold returns the form of the name that is compared to find the keys
+// that collide. Names differing only in the case or the Unicode
+// normalization are the same file on most computers.
+func keyFold(name string) string {
+	return strings.ToLower(norm.NFC.String(name))
+}
+
+// folderName prefixes the name with the folder of the file, like
+// "Show A - ep1.mp3"
+func folderName(job *Job) string {
+	dir, err := filepath.Abs(filepath.Dir(job.File))
+	if err != nil {
+		dir = filepath.Dir(job.File)
+	}
+	return safeKeyName(filepath.Base(dir) + " - " + job.FileName)
+}
+
+// collisions groups the jobs with the same key, in the order of the jobs
+func collisions(jobs []*Job) (groups [][]*Job) {
+	byKey := make(map[string][]*Job)
+	var keys []string
+	for _, job := range jobs {
+		key := keyFold(job.FileName)
+		if _, found := byKey[key]; !found {
+			keys = append(keys, key)
+		}
+		byKey[key] = append(byKey[key], job)
+	}
+	for _, key := range keys {
+		if len(byKey[key]) > 1 {
+			groups = append(groups, byKey[key])
+		}
+	}
+	return
+}
+
+// resolveCollisions makes the uploaded names safe for S3 keys and applies
+// --on-collision to the files that would overwrite each other in the bucket
+func resolveCollisions(jobs []*Job, action string) error {
+	for _, job := range jobs {
+		name := safeKeyName(job.FileName)
+		if name != norm.NFC.String(job.FileName) {
+			// the normalization alone isn't worth a warning
+			fmt.Printf("[WARN] File \"%s\" is uploaded as \"%s\", the name isn't safe for the storage\n", job.File, name)
+		}
+		if name != job.FileName {
+			job.unsafeName = job.FileName
+		}
+		job.FileName = name
+	}
+
+	groups := collisions(jobs)
+	if len(groups) == 0 {
+		return nil
+	}
+	if action == CollisionFail {
+		var lines []string
+		for _, group := range groups {
+			var files []string
+			for _, job := range group {
+				files = append(files, fmt.Sprintf("\"%s\"", job.File))
+			}
+			lines = append(lines, fmt.Sprintf("\"%s\": %s", group[0].FileName, strings.Join(files, ", ")))
+		}
+		sort.Strings(lines)
+		return errors.Errorf("These files would be uploaded under the same name, use --on-collision folder or number:\n%s",
+			strings.Join(lines, "\n"),
+		)
+	}
+
+	names := make(map[*Job]string, len(jobs))
+	for _, job := range jobs {
+		names[job] = job.FileName
+	}
+	if action == CollisionFolder {
+		for _, group := range groups {
+			for _, job := range group {
+				job.FileName = folderName(job)
+			}
+		}
+		// the files from the folders with the same name are numbered
+		groups = collisions(jobs)
+	}
+
+	taken := make(map[string]bool)
+	for _, job := range jobs {
+		taken[keyFold(job.FileName)] = true
+	}
+	for _, group := range groups {
+		// the first file keeps the name
+		for _, job := range group[1:] {
+			job.FileName = uniqueName(job.FileName, taken)
+			taken[keyFold(job.FileName)] = true
+		}
+	}
+	for _, job := range jobs {
+		if job.FileName != names[job] {
+			fmt.Printf("\"%s\" is uploaded as \"%s\"\n", job.File, job.FileName)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSafeKeyName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"ep1.mp3", "ep1.mp3"},
+		{"a/b.mp3", "a_b.mp3"},
+		{`50% {live} #3 <mix> "final"|~^.mp3`, `50_ _live_ _3 _mix_ _final____.mp3`},
+		{"back\\slash [1] `x`.mp3", "back_slash _1_ _x_.mp3"},
+		{"tab\there\n.mp3", "tab_here_.mp3"},
+		{"Café.mp3", "Café.mp3"},
+		{"Ünïcödé — ok.mp3", "Ünïcödé — ok.mp3"},
+	}
+	for _, tt := range tests {
+		if got := safeKeyName(tt.name); got != tt.want {
+			t.Errorf("safeKeyName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestKeyFold(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"Ep1.MP3", "ep1.mp3", true},
+		{"Café.mp3", "café.mp3", true},
+		{"ep1.mp3", "ep2.mp3", false},
+		{"ep1.mp3", "ep1.m4a", false},
+	}
+	for _, tt := range tests {
+		if same := keyFold(tt.a) == keyFold(tt.b); same != tt.same {
+			t.Errorf("keyFold(%q) == keyFold(%q) is %v, want %v", tt.a, tt.b, same, tt.same)
+		}
+	}
+}
+
+func TestResolveCollisions(t *testing.T) {
+	files := []string{
+		"/podcasts/Show A/ep1.mp3",
+		"/podcasts/Show B/EP1.mp3",
+		"/podcasts/Show B/ep2.mp3",
+		"/archive/Show A/ep1.mp3",
+	}
+	tests := []struct {
+		action string
+		want   []string
+	}{
+		{CollisionNumber, []string{"ep1.mp3", "EP1 (2).mp3", "ep2.mp3", "ep1 (3).mp3"}},
+		{CollisionFolder, []string{"Show A - ep1.mp3", "Show B - EP1.mp3", "ep2.mp3", "Show A - ep1 (2).mp3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			var jobs []*Job
+			for _, file := range files {
+				jobs = append(jobs, NewJob(file, 1))
+			}
+			if err := resolveCollisions(jobs, tt.action); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, job := range jobs {
+				got = append(got, job.FileName)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveCollisionsFail(t *testing.T) {
+	jobs := []*Job{
+		NewJob("/a/ep1.mp3", 1),
+		NewJob("/b/Ep1.mp3", 1),
+		NewJob("/a/ep#2.mp3", 1),
+	}
+	err := resolveCollisions(jobs, CollisionFail)
+	if err == nil {
+		t.Fatal("the collision isn't reported")
+	}
+	if want := `"ep1.mp3": "/a/ep1.mp3", "/b/Ep1.mp3"`; !strings.Contains(err.Error(), want) {
+		t.Errorf("got %q, want it to list %q", err, want)
+	}
+	if jobs[2].FileName != "ep_2.mp3" {
+		t.Errorf("the unsafe name is %q, want %q", jobs[2].FileName, "ep_2.mp3")
+	}
+
+	unique := []*Job{NewJob("/a/ep1.mp3", 1), NewJob("/a/ep2.mp3", 1)}
+	if err = resolveCollisions(unique, CollisionFail); err != nil {
+		t.Errorf("unique names: %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/Andrew-Morozko/cloudy-uploader/overcast"
+	"github.com/pkg/errors"
+	"github.com/vbauerster/mpb/v4/decor"
+)
+
+type ListArgs struct {
+	CommonArgs
+	Format string `arg:"-f,--format" help:"output format: table, json or csv" default:"table"`
+}
+
+func (ListArgs) Description() string {
+	return `Lists the files already uploaded to the Overcast account.
+`
+}
+
+func (args *ListArgs) Validate() error {
+	switch args.Format {
+	case "table", "json", "csv":
+		return nil
+	}
+	return errors.Errorf("unknown format %q", args.Format)
+}
+
+// uploadRecord is the machine-readable representation of an upload
+type uploadRecord struct {
+	Name       string `json:"name"`
+	Size       *int64 `json:"size"`
+	Date       string `json:"date,omitempty"`
+	EpisodeURL string `json:"episode_url,omitempty"`
+	DeleteURL  string `json:"delete_url,omitempty"`
+}
+
+func newUploadRecord(upload *overcast.Upload) *uploadRecord {
+	rec := &uploadRecord{
+		Name:       upload.Name,
+		EpisodeURL: upload.EpisodeURL,
+		DeleteURL:  upload.DeleteURL,
+	}
+	if upload.Size >= 0 {
+		size := upload.Size
+		rec.Size = &size
+	}
+	if !upload.Date.IsZero() {
+		rec.Date = upload.Date.Format("2006-01-02")
+	}
+	return rec
+}
+
+// Run prints the uploads.
+func (args *ListArgs) Run(ctx context.Context) (err error) {
+	_, upl, err := login(ctx, &args.CommonArgs)
+	if err != nil {
+		return
+	}
+	uploads := upl.Uploads()
+
+	records := make([]*uploadRecord, len(uploads))
+	for i, upload := range uploads {
+		records[i] = newUploadRecord(upload)
+	}
+
+	switch args.Format {
+	case "json":
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(records)
+	case "csv":
+		return writeUploadsCSV(records)
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSIZE\tUPLOADED")
+	for _, rec := range records {
+		size := "?"
+		if rec.Size != nil {
+			size = fmt.Sprintf("% .1f", decor.SizeB1000(*rec.Size))
+		}
+		date := rec.Date
+		if date == "" {
+			date = "?"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", rec.Name, size, date)
+	}
+	err = tw.Flush()
+	if err != nil {
+		return
+	}
+
+	fmt.Fprintf(stdout, "\n%d files", len(records))
+	if params, err := upl.Params(); err == nil {
+		if params.SpaceAvailable >= 0 {
+			fmt.Fprintf(stdout, ", % .1f available", decor.SizeB1000(params.SpaceAvailable))
+		}
+		if params.MaxFileCount >= 0 {
+			fmt.Fprintf(stdout, ", %d more files allowed", params.MaxFileCount)
+		}
+	}
+	fmt.Fprintln(stdout)
+	return nil
+}
+
+func writeUploadsCSV(records []*uploadRecord) error {
+	w := csv.NewWriter(stdout)
+	w.Write([]string{"name", "size", "date", "episode_url", "delete_url"})
+	for _, rec := range records {
+		size := ""
+		if rec.Size != nil {
+			size = strconv.FormatInt(*rec.Size, 10)
+		}
+		w.Write([]string{rec.Name, size, rec.Date, rec.EpisodeURL, rec.DeleteURL})
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -2,17 +2,19 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
-	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"strings"
 
+	"github.com/Andrew-Morozko/cloudy-uploader/media"
+	"github.com/Andrew-Morozko/cloudy-uploader/overcast"
 	"github.com/alexflint/go-arg"
 	"github.com/pkg/errors"
-	"github.com/shibukawa/configdir"
 	"github.com/vbauerster/mpb/v4/decor"
 	"github.com/zalando/go-keyring"
 )
@@ -24,12 +26,20 @@ var (
 	userAgent = appName + "/" + version + " CLI Uploader; " + appURL
 )
 
-var overcastURL = URLMustParse("https://overcast.fm/")
 var debug = false
-var client = NewHTTPClient()
+
+// stdout is the real standard output, for the data requested by the user,
+// it isn't affected by --silent
+var stdout = os.Stdout
 var keyringUsable = true
 
-var allowedExts = ExtList{"mp3", "m4a", "aac", "wav", "m4b"}
+// keyringUser is the keyring entry the credentials are stored in.
+// Credentials for a non-default --base-url are kept separately.
+var keyringUser = "creds"
+
+// defaultAllowedExts are used if the uploads page doesn't list the accepted
+// file types
+var defaultAllowedExts = ExtList{"mp3", "m4a", "aac", "wav", "m4b"}
 
 type ExtList []string
 
@@ -44,26 +54,159 @@ func (el ExtList) Inclues(ext string) bool {
 	return false
 }
 
+// allowedExts returns the extensions of the files Overcast accepts
+func allowedExts(params *overcast.Params) ExtList {
+	if len(params.AllowedExts) != 0 {
+		return ExtList(params.AllowedExts)
+	}
+	return defaultAllowedExts
+}
+
+// CommonArgs are the options shared by all commands
+type CommonArgs struct {
+	Login       string `help:"email for Overcast account"`
+	Password    string `help:"password for Overcast account"`
+	SaveCreds   *bool  `arg:"--save-creds" help:"save credentials in secure system storge"`
+	NoLoadCreds bool   `arg:"--no-load-creds" help:"do not use stored creds"`
+	Silent      bool   `arg:"-s" help:"disable user interaction"`
+	BaseURL     string `arg:"--base-url,env:CLOUDYUPLOADER_BASE_URL" help:"address of the Overcast website, useful for testing" default:"https://overcast.fm/" placeholder:"URL"`
+}
+
+func (ca *CommonArgs) Common() *CommonArgs {
+	return ca
+}
+
+// Command is a cloudyuploader command, parsed from the command line.
+type Command interface {
+	Common() *CommonArgs
+	// Validate checks the arguments after parsing
+	Validate() error
+	Run(ctx context.Context) error
+}
+
+// commands are the named subcommands, uploading the files is the default one
+var commands = map[string]func() Command{
+	"resubmit": func() Command { return &ResubmitArgs{} },
+	"resume":   func() Command { return &ResumeArgs{} },
+	"list":     func() Command { return &ListArgs{} },
+	"delete":   func() Command { return &DeleteArgs{} },
+	"history":  func() Command { return &HistoryArgs{} },
+}
+
+// UploadArgs are the options of the commands that upload files
+type UploadArgs struct {
+	MaxParallel     int    `arg:"-j,--parallel-uploads" help:"maximum number of concurrent uploads" default:"4" placeholder:"N"`
+	UnorderedSubmit bool   `arg:"--unordered-submit" help:"don't wait to submit uploads in proper order"`
+	Retries         int    `arg:"--retries" help:"how many times to retry a failed upload" default:"3" placeholder:"N"`
+	OnChange        string `arg:"--on-change" help:"what to do with the files that change while they're uploaded: retry (once, after they stop changing) or fail" default:"retry" placeholder:"ACTION"`
+	CheckHash       bool   `arg:"--check-hash" help:"hash the files before the upload and check the uploaded data against it"`
+	Verify          bool   `arg:"--verify" help:"have S3 check the MD5 of the uploaded data and look for the files on the uploads page after the submission"`
+}
+
+func (args *UploadArgs) Validate() error {
+	if args.MaxParallel < 1 {
+		return errors.New("--parallel-uploads should be at least 1")
+	}
+	if args.Retries < 0 {
+		return errors.New("--retries can't be negative")
+	}
+	switch args.OnChange {
+	case "":
+		args.OnChange = ChangeRetry
+	case ChangeRetry, ChangeFail:
+	default:
+		return errors.Errorf("unknown --on-change action %q", args.OnChange)
+	}
+	return nil
+}
+
 type Args struct {
-	Files           []string `arg:"--file,positional,required" help:"files to be uploaded"`
-	Login           string   `help:"email for Overcast account"`
-	Password        string   `help:"password for Overcast account"`
-	SaveCreds       *bool    `arg:"--save-creds" help:"save credentials in secure system storge"`
-	NoLoadCreds     bool     `arg:"--no-load-creds" help:"do not use stored creds"`
-	MaxParallel     int      `arg:"-j,--parallel-uploads" help:"maximum number of concurrent uploads" default:"4" placeholder:"N"`
-	Silent          bool     `arg:"-s" help:"disable user interaction"`
-	UnorderedSubmit bool     `arg:"--unordered-submit" help:"don't wait to submit uploads in proper order"`
+	Files []string `arg:"--file,positional,required" help:"files to be uploaded"`
+	CommonArgs
+	UploadArgs
+	PrepareArgs
+	TagArgs
+	OnDuplicate  string   `arg:"--on-duplicate" help:"what to do with the files that are already uploaded: ask, skip, overwrite or rename (default: ask, skip with --silent)" placeholder:"ACTION"`
+	OnCollision  string   `arg:"--on-collision" help:"what to do with the files from different folders that would get the same name: fail, folder (prefix the folder name) or number" default:"fail" placeholder:"ACTION"`
+	AllowExt     []string `arg:"--allow-ext,separate" help:"extensions of the files to upload, instead of the ones the uploads page accepts" placeholder:"EXT"`
+	NameTemplate string   `arg:"--name-template" help:"name of the uploaded files made of {name}, {ext}, {date:LAYOUT} (modification time), {n:03} (number in the batch) and the tags like {album} or {track:03}" placeholder:"TEMPLATE"`
+	DiscardQueue bool     `arg:"--discard-queue" help:"start a new batch even if the last one isn't finished, it can't be resumed afterwards"`
+
+	nameTemplate nameTemplate
+}
+
+func (args *Args) Validate() error {
+	switch args.OnDuplicate {
+	case "":
+		args.OnDuplicate = DuplicateAsk
+		if args.Silent {
+			args.OnDuplicate = DuplicateSkip
+		}
+	case DuplicateAsk:
+		if args.Silent {
+			return errors.New("--on-duplicate=ask can't be used with --silent")
+		}
+	case DuplicateSkip, DuplicateOverwrite, DuplicateRename:
+	default:
+		return errors.Errorf("unknown --on-duplicate action %q", args.OnDuplicate)
+	}
+	switch args.OnCollision {
+	case "":
+		args.OnCollision = CollisionFail
+	case CollisionFail, CollisionFolder, CollisionNumber:
+	default:
+		return errors.Errorf("unknown --on-collision action %q", args.OnCollision)
+	}
+	var exts []string
+	for _, value := range args.AllowExt {
+		for _, ext := range strings.Split(value, ",") {
+			ext = strings.TrimLeft(strings.ToLower(strings.TrimSpace(ext)), ".")
+			if ext != "" {
+				exts = append(exts, ext)
+			}
+		}
+	}
+	args.AllowExt = exts
+	err := args.PrepareArgs.Validate()
+	if err != nil {
+		return err
+	}
+	err = args.TagArgs.Validate()
+	if err != nil {
+		return err
+	}
+	if args.Chapters != "" && (len(args.Files) > 1 || args.Concat || args.SplitChapters) {
+		return errors.New("--chapters can only be used with a single file, put NAME.chapters.txt next to every file instead")
+	}
+	if args.NameTemplate != "" {
+		args.nameTemplate, err = parseNameTemplate(args.NameTemplate)
+		if err != nil {
+			return errors.WithMessage(err, "invalid --name-template")
+		}
+		if args.nameTemplate.needsTags() {
+			if _, err = exec.LookPath(media.FFprobe); err != nil {
+				return errors.Errorf("%s not found, it's needed to read the tags for --name-template", media.FFprobe)
+			}
+		}
+	}
+	return args.UploadArgs.Validate()
 }
 
 func (Args) Description() string {
 	return `Unofficial CLI file uploader for Overcast. Version ` + version + `
 Technically it's just a wrapper around upload a form at https://overcast.fm/uploads
+
+Other commands (run "` + appName + ` COMMAND --help" for details):
+  list                   list the files already uploaded to the account
+  delete                 delete uploaded files from the account
+  history                show the files uploaded from this computer
+  resume                 continue the last interrupted batch of uploads
+  resubmit               submit uploads that were interrupted before reaching Overcast
 `
 }
 
 func migrateToKeyring() {
-	configDirs := configdir.New("", appName)
-	configDir := configDirs.QueryFolders(configdir.Global)[0]
+	configDir := configDir()
 
 	if !configDir.Exists("config.json") {
 		return
@@ -74,7 +217,7 @@ func migrateToKeyring() {
 		return
 	}
 
-	var cfg AuthData
+	var cfg overcast.AuthData
 	err = json.Unmarshal(data, &cfg)
 	if err != nil {
 		fmt.Printf("[WARN] Invalid JSON config file: %s\n", err)
@@ -85,16 +228,16 @@ func migrateToKeyring() {
 	if err != nil {
 		fmt.Printf("[WARN] Failed to save credentials: %s\n", err)
 	}
-	os.RemoveAll(configDir.Path)
+	os.Remove(filepath.Join(configDir.Path, "config.json"))
 }
 
-func loadCreds() (authData *AuthData) {
+func loadCreds() (authData *overcast.AuthData) {
 	if !keyringUsable {
 		return nil
 	}
 	migrateToKeyring()
 
-	data, err := keyring.Get(appName, "creds")
+	data, err := keyring.Get(appName, keyringUser)
 	if err != nil {
 		if err == keyring.ErrNotFound {
 			return
@@ -111,7 +254,7 @@ func loadCreds() (authData *AuthData) {
 		fmt.Printf("[WARN] Failed to load credentials: %s\n", err)
 		return
 	}
-	authData, err = ParseAuthData([]byte(data))
+	authData, err = overcast.ParseAuthData([]byte(data))
 	if err != nil {
 		fmt.Printf("[WARN] Failed to load credentials: %s\n", err)
 		authData = nil
@@ -119,7 +262,7 @@ func loadCreds() (authData *AuthData) {
 	return
 }
 
-func saveCreds(ad *AuthData) {
+func saveCreds(ad *overcast.AuthData) {
 	if !keyringUsable {
 		return
 	}
@@ -128,7 +271,7 @@ func saveCreds(ad *AuthData) {
 		return
 	}
 
-	err = keyring.Set(appName, "creds", string(data))
+	err = keyring.Set(appName, keyringUser, string(data))
 	if err != nil {
 		if t, ok := err.(*exec.ExitError); ok {
 			if t.ExitCode() == 36 {
@@ -144,17 +287,38 @@ func saveCreds(ad *AuthData) {
 	}
 }
 
-func parseArgs() (args *Args, err error) {
-	args = &Args{}
+// newCommand returns the command named by the first flag, uploading the
+// files if it isn't one, and the flags of the command
+func newCommand(flags []string) (cmd Command, program string, cmdFlags []string) {
+	if len(flags) > 0 {
+		if newCmd, found := commands[flags[0]]; found {
+			return newCmd(), appName + " " + flags[0], flags[1:]
+		}
+	}
+	return &Args{}, appName, flags
+}
 
-	arg.MustParse(args)
+func parseArgs() (cmd Command, err error) {
+	cmd, program, flags := newCommand(os.Args[1:])
+	p, err := arg.NewParser(arg.Config{Program: program}, cmd)
+	if err != nil {
+		return
+	}
+	err = p.Parse(flags)
+	switch {
+	case err == arg.ErrHelp:
+		p.WriteHelp(os.Stdout)
+		os.Exit(0)
+	case err != nil:
+		p.Fail(err.Error())
+	}
 
-	if args.MaxParallel < 1 {
-		err = errors.New("--parallel-uploads should be at least 1")
+	err = cmd.Validate()
+	if err != nil {
 		return
 	}
 
-	if args.Silent {
+	if cmd.Common().Silent {
 		os.Stdout, err = os.Open(os.DevNull)
 		if err != nil {
 			err = errors.WithMessage(err, "can't open devnull")
@@ -175,98 +339,69 @@ func Input(prompt string) (answer string, err error) {
 	return
 }
 
-func PerformAuth(args *Args) (uploads *http.Response, err error) {
-	var ad *AuthData
-	// auth with command line data
-	if args.Login != "" && args.Password != "" {
-		ad = &AuthData{
-			Creds: &Creds{
-				args.Login,
-				args.Password,
-			},
-		}
-		uploads, err = ad.Auth()
-		if err == nil {
-			if args.SaveCreds != nil && *args.SaveCreds {
-				saveCreds(ad)
+func parseFiles(ctx context.Context, files []string, overcastParams *overcast.Params, prepArgs *PrepareArgs) (jobs []*Job) {
+	allowed := allowedExts(overcastParams)
+	for _, file := range files {
+		transcode := false
+		if !allowed.Inclues(filepath.Ext(file)) {
+			if !prepArgs.Transcode {
+				fmt.Printf("[WARN] File \"%s\" is not allowed. Allowed extentions: %s\n", file, strings.Join(allowed, ", "))
+				continue
 			}
-			return
-		} else {
-			fmt.Printf("[WARN] Failed to authenticate with supplied login/passowrd: %s\n", err)
+			transcode = true
 		}
-	}
 
-	// auth with cookies/saved password
-	if !args.NoLoadCreds {
-		ad = loadCreds()
-		if ad != nil {
-			uploads, err = ad.Auth()
-			if err == staleCookiesErr {
-				// refresh saved cookies
-				saveCreds(ad)
-				err = nil
-			}
-			if err == nil {
-				return
+		stat, err := os.Stat(file)
+		if err != nil {
+			if os.IsNotExist(err) {
+				fmt.Printf("[WARN] File \"%s\" doesn't exist\n", file)
 			} else {
-				fmt.Printf("[WARN] Failed to authenticate with saved login/passowrd: %s\n", err)
+				fmt.Printf("[WARN] Error with file \"%s\": %s\n", file, err)
 			}
+			continue
 		}
-	}
 
-	// auth with input password
-	if !args.Silent {
-		ad = &AuthData{
-			Creds: inputCreds(),
+		fileSize := stat.Size()
+		if !transcode {
+			if err = checkAudio(file, fileSize); err != nil {
+				fmt.Printf("[WARN] File \"%s\" %s\n", file, err)
+				continue
+			}
 		}
-		if ad.Creds != nil {
-			uploads, err = ad.Auth()
-			if err == nil {
-				if args.SaveCreds == nil {
-					// Ask to save
-					answer, err2 := Input("Do you want to store the email/password securely on your system? [y/N]: ")
-					if err2 != nil {
-						fmt.Printf("\n[WARN] Failed to get answer: %s\n", err2)
-						return
-					}
-
-					if len(answer) >= 1 && (answer[0] == 'Y' || answer[0] == 'y') {
-						saveCreds(ad)
-					}
-				} else {
-					if *args.SaveCreds {
-						saveCreds(ad)
-					}
-				}
-				return
-			} else {
-				fmt.Printf("[WARN] Failed to authenticate with entered login/passowrd: %s\n", err)
+		if prepArgs.SplitChapters {
+			var transcodeCmd media.Command
+			if transcode {
+				transcodeCmd = prepArgs.transcodeCmd
+			}
+			chapters, err := chapterJobs(ctx, file, fileSize, overcastParams, transcodeCmd, prepArgs.TranscodeFormat)
+			if err != nil {
+				fmt.Printf("[WARN] Failed to split \"%s\" into chapters: %s\n", file, err)
+				continue
+			}
+			if chapters != nil {
+				jobs = append(jobs, chapters...)
+				continue
 			}
 		}
-	}
-	uploads = nil
-	err = errors.New("all availible methods failed")
-	return
-}
-func parseFiles(files []string, overcastParams *OvercastParams) (jobs []*Job) {
-	for _, file := range files {
-		if !allowedExts.Inclues(filepath.Ext(file)) {
-			fmt.Printf("[WARN] File \"%s\" is not allowed. Allowed extentions: %s\n", file, strings.Join(allowedExts, ", "))
+		if transcode {
+			// the size is checked after transcoding
+			job := NewJob(file, fileSize)
+			job.FileName = strings.TrimSuffix(job.FileName, filepath.Ext(job.FileName)) + "." + prepArgs.TranscodeFormat
+			job.Prep = &Preparation{Transcode: prepArgs.transcodeCmd}
+			job.uploadSize = -1
+			jobs = append(jobs, job)
 			continue
 		}
-
-		stat, err := os.Stat(file)
-		if err != nil {
-			if os.IsNotExist(err) {
-				fmt.Printf("[WARN] File \"%s\" doesn't exist\n", file)
-			} else {
-				fmt.Printf("[WARN] Error with file \"%s\": %s\n", file, err)
+		if overcastParams.MaxFileSize >= 0 && fileSize > overcastParams.MaxFileSize && prepArgs.SplitOversize {
+			parts, err := splitFile(ctx, file, fileSize, overcastParams.MaxFileSize, prepArgs.SplitAt == "silence")
+			if err != nil {
+				fmt.Printf("[WARN] Failed to split \"%s\": %s\n", file, err)
+				continue
 			}
+			jobs = append(jobs, parts...)
 			continue
 		}
-
-		fileSize := stat.Size()
-		if fileSize > overcastParams.MaxFileSize {
+		if overcastParams.MaxFileSize >= 0 && fileSize > overcastParams.MaxFileSize {
 			fmt.Printf(
 				"[WARN] File \"%s\" is too large: file size=% .2f, max file size=% .2f\n",
 				file, decor.SizeB1000(fileSize), decor.SizeB1000(overcastParams.MaxFileSize),
@@ -278,6 +413,57 @@ func parseFiles(files []string, overcastParams *OvercastParams) (jobs []*Job) {
 	return
 }
 
+// extContainers are the formats of the files with the extensions
+var extContainers = map[string]string{
+	"mp3": media.ContainerMP3,
+	"aac": media.ContainerADTS,
+	"m4a": media.ContainerMP4,
+	"m4b": media.ContainerMP4,
+	"wav": media.ContainerWAV,
+}
+
+// checkAudio checks the headers of the file. Empty, corrupt and non-audio
+// files are rejected, a format not matching the extension is reported.
+func checkAudio(file string, size int64) error {
+	if size == 0 {
+		return errors.New("is empty")
+	}
+	ext := strings.TrimLeft(strings.ToLower(filepath.Ext(file)), ".")
+	expected, known := extContainers[ext]
+	if !known {
+		return nil
+	}
+	header, err := media.Sniff(file)
+	if err == media.ErrNotAudio {
+		return errors.New("isn't an audio file")
+	}
+	if err != nil {
+		return errors.WithMessage(err, "is corrupt")
+	}
+	if header.Duration <= 0 {
+		return errors.New("has no audio")
+	}
+	if header.Container != expected {
+		fmt.Printf("[WARN] File \"%s\" is %s, not %s, Overcast might reject it\n", file, header.Container, expected)
+	}
+	return nil
+}
+
+func warnUnknownLimits(params *overcast.Params) {
+	if params.SpaceAvailable < 0 {
+		fmt.Println("[WARN] Failed to get space limit, upload might fail")
+	}
+	if params.MaxFileSize < 0 {
+		fmt.Println("[WARN] Failed to get file size limit, upload might fail")
+	}
+	if params.MaxFileCount < 0 {
+		fmt.Println("[WARN] Failed to get total files limit, upload might fail")
+	}
+	if params.Policy == nil && params.PostField("policy") != "" {
+		fmt.Println("[WARN] Failed to decode the upload policy, upload might fail")
+	}
+}
+
 func main() {
 	var err error
 
@@ -288,50 +474,252 @@ func main() {
 		}
 	}()
 
-	args, err := parseArgs()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	cmd, err := parseArgs()
 	if err != nil {
 		err = errors.WithMessage(err, "Arguments error")
 		return
 	}
 
-	upl, err := PerformAuth(args)
+	err = cmd.Run(ctx)
+}
+
+// login logs in to Overcast.
+func login(ctx context.Context, args *CommonArgs) (oc *overcast.Client, upl *overcast.UploadsPage, err error) {
+	oc, err = overcast.NewClient(NewHTTPClient(), args.BaseURL)
+	if err != nil {
+		err = errors.WithMessage(err, "Arguments error")
+		return
+	}
+	if oc.BaseURL.String() != overcast.DefaultBaseURL {
+		keyringUser = "creds@" + oc.BaseURL.Host
+	}
+
+	upl, err = PerformAuth(ctx, oc, args)
 	if err != nil {
 		err = errors.WithMessage(err, "Auth failed")
+	}
+	return
+}
+
+// connect logs in to Overcast and parses the upload form.
+func connect(ctx context.Context, args *CommonArgs) (uploader *overcast.Uploader, upl *overcast.UploadsPage, err error) {
+	oc, upl, err := login(ctx, args)
+	if err != nil {
 		return
 	}
 
-	overcastParams, err := parseUploadsPage(upl.Body)
-	upl.Body.Close()
+	overcastParams, err := upl.Params()
 	if err != nil {
 		err = errors.WithMessage(err, "Failed to parse the uploads page")
 		return
 	}
+	warnUnknownLimits(overcastParams)
+
+	return oc.NewUploader(overcastParams), upl, nil
+}
+
+// Run uploads the files.
+func (args *Args) Run(ctx context.Context) (err error) {
+	err = args.checkQueue()
+	if err != nil {
+		return
+	}
+	uploader, upl, err := connect(ctx, &args.CommonArgs)
+	if err != nil {
+		return
+	}
+	overcastParams := uploader.Params
+	if len(args.AllowExt) != 0 {
+		overcastParams.AllowedExts = args.AllowExt
+	}
 
-	jobs := parseFiles(args.Files, overcastParams)
+	journal, err := OpenJournal()
+	if err != nil {
+		fmt.Printf("[WARN] Failed to open the journal, interrupted uploads won't be resumable: %s\n", err)
+		journal = nil
+	}
 
+	history, err := OpenHistory()
+	if err != nil {
+		fmt.Printf("[WARN] Failed to open the history, the uploads won't be recorded: %s\n", err)
+		history = nil
+	}
+
+	var jobs []*Job
+	if args.Concat {
+		if job := concatFiles(ctx, args.Files, overcastParams, &args.PrepareArgs); job != nil {
+			jobs = append(jobs, job)
+		}
+	} else {
+		jobs = parseFiles(ctx, args.Files, overcastParams, &args.PrepareArgs)
+	}
+	if args.Normalize != 0 {
+		normalizeJobs(jobs, args.Normalize)
+	}
+	args.TagArgs.tagJobs(ctx, jobs)
+	args.TagArgs.addChapters(ctx, jobs)
+	if args.nameTemplate != nil {
+		args.nameTemplate.renameJobs(ctx, jobs)
+	}
+	err = resolveCollisions(jobs, args.OnCollision)
+	if err != nil {
+		return
+	}
 	if len(jobs) == 0 {
 		err = errors.New("No files to upload!")
 		return
 	}
 
-	if len(jobs) > overcastParams.MaxFileCount {
-		err = errors.Errorf("You've chosen too many files(%d), you only have %d files remaining",
-			len(jobs), overcastParams.MaxFileCount,
-		)
+	jobs, overwritten := args.dedup(jobs, upl.Uploads(), history.Entries(uploader.Client.BaseURL.String()))
+	if len(jobs) == 0 {
+		fmt.Println("All files are already uploaded")
+		return
+	}
+
+	limits := freedLimits(overcastParams, overwritten)
+	err = checkLimits(jobs, limits)
+	if err != nil {
+		return
+	}
+
+	jobs = deleteOverwritten(ctx, uploader.Client, jobs, overwritten)
+	if len(jobs) == 0 {
+		err = errors.New("No files to upload!")
 		return
 	}
 
+	queue, err := NewQueue(uploader.Client.BaseURL.String(), jobs)
+	if err != nil {
+		fmt.Printf("[WARN] Failed to save the queue, the uploads won't be resumable: %s\n", err)
+		queue = nil
+	}
+
+	return upload(ctx, jobs, &args.UploadArgs, uploader, limits, journal, history, queue)
+}
+
+// checkQueue refuses to replace the queue of an unfinished batch, unless
+// --discard-queue is set
+func (args *Args) checkQueue() error {
+	queue, err := LoadQueue()
+	if err != nil {
+		fmt.Printf("[WARN] The saved queue will be replaced: %s\n", err)
+		return nil
+	}
+	if queue == nil || queue.Finished() {
+		return nil
+	}
+	var unfinished int
+	for _, qj := range queue.Jobs {
+		if !qj.Finished() {
+			unfinished++
+		}
+	}
+	if args.DiscardQueue {
+		fmt.Printf("[WARN] Discarding the last batch, %d of its files weren't submitted\n", unfinished)
+		return nil
+	}
+	return errors.Errorf("The last batch isn't finished, %d of its files weren't submitted. "+
+		"Run \"%s resume\" to continue it or use --discard-queue to start a new one", unfinished, appName)
+}
+
+// checkLimits checks that the unfinished jobs fit into the account limits
+func checkLimits(jobs []*Job, overcastParams *overcast.Params) (err error) {
+	var count int
 	var totalSize int64
 	for _, job := range jobs {
-		totalSize += job.FileSize
+		if job.isDone {
+			continue
+		}
+		count++
+		if !job.uploaded && job.UploadSize() >= 0 {
+			totalSize += job.UploadSize()
+		}
 	}
 
-	if totalSize > overcastParams.SpaceAvailible {
+	if overcastParams.MaxFileCount >= 0 && count > overcastParams.MaxFileCount {
+		err = errors.Errorf("You've chosen too many files(%d), you only have %d files remaining",
+			count, overcastParams.MaxFileCount,
+		)
+		return
+	}
+
+	if overcastParams.SpaceAvailable >= 0 && totalSize > overcastParams.SpaceAvailable {
 		err = errors.Errorf("Files are too large: total size=% .2f; you have % .2f availible\n",
-			decor.SizeB1000(totalSize), decor.SizeB1000(overcastParams.SpaceAvailible),
+			decor.SizeB1000(totalSize), decor.SizeB1000(overcastParams.SpaceAvailable),
 		)
 		return
 	}
+	return
+}
+
+// checkPolicy fails the jobs the upload form would reject. The sizes of the
+// jobs that aren't prepared yet are checked once they are.
+func checkPolicy(jobs []*Job, uploader *overcast.Uploader) {
+	for _, job := range jobs {
+		if job.isDone || job.uploaded {
+			continue
+		}
+		size := job.UploadSize()
+		if job.Prep != nil && job.uploadFile == "" {
+			// only an estimate
+			size = -1
+		}
+		if err := uploader.Check(job.FileName, size); err != nil {
+			job.Reject(err.Error())
+		}
+	}
+}
+
+// upload prepares the files, performs the upload and reports the problems.
+// The limits are checked again once the sizes of the prepared files are known.
+func upload(ctx context.Context, jobs []*Job, args *UploadArgs, uploader *overcast.Uploader, limits *overcast.Params, journal *Journal, history *History, queue *Queue) (err error) {
+	uploader.Retry.MaxAttempts = args.Retries + 1
+
+	td := &tempDir{}
+	defer td.Remove()
+
+	bars := newProgress(jobs)
+	checkPolicy(jobs, uploader)
+	prepareJobs(ctx, jobs, uploader.Params, args.MaxParallel, td)
+	checkPolicy(jobs, uploader)
+	err = checkLimits(jobs, limits)
+	if err != nil {
+		return abortJobs(bars, jobs, err)
+	}
+
+	failed := performUpload(ctx, bars, jobs, args, uploader, journal, history)
+
+	if journal.Err() != nil {
+		fmt.Printf("[WARN] Failed to save the journal: %s\n", journal.Err())
+	}
+	if history.Err() != nil {
+		fmt.Printf("[WARN] Failed to save the history: %s\n", history.Err())
+	}
+	if queue.Err() != nil {
+		fmt.Printf("[WARN] Failed to save the queue: %s\n", queue.Err())
+	} else if queue != nil && queue.Finished() {
+		queue.Remove()
+	}
 
-	performUpload(jobs, args.MaxParallel, args.UnorderedSubmit, overcastParams)
+	if failed != 0 {
+		// the unverified and the rejected ones can't be retried
+		var resumable int
+		for _, job := range jobs {
+			if job.failed && !job.submitted && !job.rejected {
+				resumable++
+			}
+		}
+		switch {
+		case queue == nil || resumable == 0:
+			err = errors.Errorf("%d of %d uploads failed", failed, len(jobs))
+		case resumable == failed:
+			err = errors.Errorf(`%d of %d uploads failed, run "%s resume" to retry them`, failed, len(jobs), appName)
+		default:
+			err = errors.Errorf(`%d of %d uploads failed, run "%s resume" to retry %d of them`, failed, len(jobs), appName, resumable)
+		}
+	}
+	return
 }
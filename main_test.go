@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Andrew-Morozko/cloudy-uploader/overcasttest"
+	"github.com/alexflint/go-arg"
+	"github.com/shibukawa/configdir"
+)
+
+// useConfigDir points the config folder to a temporary one for the test
+func useConfigDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	old := configDir
+	configDir = func() *configdir.Config {
+		return &configdir.Config{Path: dir, Type: configdir.Global}
+	}
+	t.Cleanup(func() { configDir = old })
+	return dir
+}
+
+// fastDelays shortens the pauses of the uploads for the test
+func fastDelays(t *testing.T) {
+	submitDelay, stable, delays := overcastSubmitDelay, stableTime, verifyDelays
+	overcastSubmitDelay = time.Millisecond
+	stableTime = 10 * time.Millisecond
+	verifyDelays = []time.Duration{time.Millisecond, time.Millisecond}
+	t.Cleanup(func() {
+		overcastSubmitDelay, stableTime, verifyDelays = submitDelay, stable, delays
+	})
+}
+
+// runCLI runs the command line against the fake server, logging in with
+// its credentials
+func runCLI(srv *overcasttest.Server, flags ...string) error {
+	cmd, program, flags := newCommand(flags)
+	flags = append(flags, "--base-url", srv.URL, "--no-load-creds", "--login", srv.Email, "--password", srv.Password)
+	p, err := arg.NewParser(arg.Config{Program: program}, cmd)
+	if err != nil {
+		return err
+	}
+	if err = p.Parse(flags); err != nil {
+		return err
+	}
+	if err = cmd.Validate(); err != nil {
+		return err
+	}
+	return cmd.Run(context.Background())
+}
+
+// writeMP3 writes an mp3 file of n frames, 417 bytes each, into the folder
+func writeMP3(t *testing.T, dir, name string, frames int) (path string, data []byte) {
+	t.Helper()
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x64})
+	data = bytes.Repeat(frame, frames)
+	path = filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path, data
+}
+
+func TestValidateAllowExt(t *testing.T) {
+	tests := []struct {
+		in   []string
+		want []string
+	}{
+		{[]string{"mp3"}, []string{"mp3"}},
+		{[]string{".MP3", "ogg,.flac"}, []string{"mp3", "ogg", "flac"}},
+		{[]string{" , .", ""}, nil},
+	}
+	for _, tt := range tests {
+		args := &Args{Files: []string{"a.mp3"}, AllowExt: tt.in}
+		args.MaxParallel = 1
+		if err := args.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(args.AllowExt, tt.want) {
+			t.Errorf("--allow-ext %q gives %q, want %q", tt.in, args.AllowExt, tt.want)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package media
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Chapter is a titled part of a file.
+type Chapter struct {
+	Start, End time.Duration
+	Title      string
+}
+
+// CueSheet is the parsed .cue file.
+type CueSheet struct {
+	Title     string
+	Performer string
+	// File is the audio file the sheet describes
+	File   string
+	Tracks []CueTrack
+}
+
+// CueTrack is a track of the cue sheet.
+type CueTrack struct {
+	Number    int
+	Title     string
+	Performer string
+	// Start is the position of the INDEX 01 of the track
+	Start time.Duration
+}
+
+// cueFields splits the cue sheet line into the command and the arguments,
+// quoted arguments can contain spaces
+func cueFields(line string) (fields []string) {
+	for line = strings.TrimSpace(line); line != ""; line = strings.TrimSpace(line) {
+		if line[0] == '"' {
+			end := strings.IndexByte(line[1:], '"')
+			if end < 0 {
+				return append(fields, line[1:])
+			}
+			fields = append(fields, line[1:end+1])
+			line = line[end+2:]
+			continue
+		}
+		end := strings.IndexAny(line, " \t")
+		if end < 0 {
+			return append(fields, line)
+		}
+		fields = append(fields, line[:end])
+		line = line[end:]
+	}
+	return
+}
+
+// parseCueTime parses the MM:SS:FF position, there are 75 frames a second
+func parseCueTime(s string) (time.Duration, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, errors.Errorf("invalid position %q", s)
+	}
+	var values [3]int
+	for i, part := range parts {
+		value, err := strconv.Atoi(part)
+		if err != nil || value < 0 {
+			return 0, errors.Errorf("invalid position %q", s)
+		}
+		values[i] = value
+	}
+	return time.Duration(values[0])*time.Minute +
+		time.Duration(values[1])*time.Second +
+		time.Duration(values[2])*time.Second/75, nil
+}
+
+// ParseCue parses the cue sheet. Only the sheets describing a single file
+// are supported.
+func ParseCue(r io.Reader) (*CueSheet, error) {
+	sheet := &CueSheet{}
+	var track *CueTrack
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		if lineNo == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		fields := cueFields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "FILE":
+			if sheet.File != "" {
+				return nil, errors.New("cue sheets with several files aren't supported")
+			}
+			if len(fields) > 1 {
+				sheet.File = fields[1]
+			}
+		case "TRACK":
+			if len(fields) < 2 {
+				return nil, errors.Errorf("line %d: track without a number", lineNo)
+			}
+			number, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return nil, errors.Errorf("line %d: invalid track number %q", lineNo, fields[1])
+			}
+			sheet.Tracks = append(sheet.Tracks, CueTrack{Number: number, Start: -1})
+			track = &sheet.Tracks[len(sheet.Tracks)-1]
+		case "TITLE", "PERFORMER":
+			if len(fields) < 2 {
+				continue
+			}
+			isTitle := strings.ToUpper(fields[0]) == "TITLE"
+			switch {
+			case track == nil && isTitle:
+				sheet.Title = fields[1]
+			case track == nil:
+				sheet.Performer = fields[1]
+			case isTitle:
+				track.Title = fields[1]
+			default:
+				track.Performer = fields[1]
+			}
+		case "INDEX":
+			if track == nil || len(fields) < 3 || fields[1] != "01" {
+				continue
+			}
+			start, err := parseCueTime(fields[2])
+			if err != nil {
+				return nil, errors.Errorf("line %d: %s", lineNo, err)
+			}
+			track.Start = start
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for _, track := range sheet.Tracks {
+		if track.Start < 0 {
+			return nil, errors.Errorf("track %d has no INDEX 01", track.Number)
+		}
+	}
+	return sheet, nil
+}
+
+// Chapters returns the tracks as chapters of a file of the duration.
+func (sheet *CueSheet) Chapters(duration time.Duration) ([]Chapter, error) {
+	chapters := make([]Chapter, len(sheet.Tracks))
+	for i, track := range sheet.Tracks {
+		end := duration
+		if i+1 < len(sheet.Tracks) {
+			end = sheet.Tracks[i+1].Start
+		}
+		if end <= track.Start {
+			return nil, errors.Errorf("track %d ends before it starts", track.Number)
+		}
+		chapters[i] = Chapter{Start: track.Start, End: end, Title: track.Title}
+	}
+	return chapters, nil
+}
+
+// parseTimestamp parses the [HH:]MM:SS[.mmm] position
+func parseTimestamp(s string) (time.Duration, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, errors.Errorf("invalid timestamp %q", s)
+	}
+	var seconds float64
+	for i, part := range parts {
+		last := i == len(parts)-1
+		value, err := strconv.ParseFloat(part, 64)
+		if err != nil || value < 0 || (!last && strings.Contains(part, ".")) || (i != 0 && value >= 60) {
+			return 0, errors.Errorf("invalid timestamp %q", s)
+		}
+		seconds = seconds*60 + value
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// ChapterList is a list of chapter starts, the chapters end where the next
+// one starts.
+type ChapterList []Chapter
+
+// ParseChapterList parses the chapters written one per line as
+// "HH:MM:SS Title", the hours and the fractions of a second are optional.
+// Empty lines and lines starting with # are skipped. The invalid lines are
+// skipped too and returned as warnings.
+func ParseChapterList(r io.Reader) (list ChapterList, warnings []error, err error) {
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		if lineNo == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		timestamp, title := line, ""
+		if end := strings.IndexAny(line, " \t"); end >= 0 {
+			timestamp, title = line[:end], strings.TrimSpace(line[end:])
+		}
+		start, err := parseTimestamp(timestamp)
+		if err != nil {
+			warnings = append(warnings, errors.Errorf("line %d: %s", lineNo, err))
+			continue
+		}
+		list = append(list, Chapter{Start: start, Title: title})
+	}
+	return list, warnings, scanner.Err()
+}
+
+// ParseChapterJSON parses the chapters written as a JSON array of objects
+// like {"start": "01:02:03", "title": "Title"}. The chapters with invalid
+// starts are skipped and returned as warnings.
+func ParseChapterJSON(r io.Reader) (list ChapterList, warnings []error, err error) {
+	var entries []struct {
+		Start string `json:"start"`
+		Title string `json:"title"`
+	}
+	if err = json.NewDecoder(r).Decode(&entries); err != nil {
+		return
+	}
+	for i, entry := range entries {
+		start, err := parseTimestamp(entry.Start)
+		if err != nil {
+			warnings = append(warnings, errors.Errorf("chapter %d: %s", i+1, err))
+			continue
+		}
+		list = append(list, Chapter{Start: start, Title: entry.Title})
+	}
+	return list, warnings, nil
+}
+
+// Chapters returns the chapters of a file of the duration. The chapters out
+// of order or past the end are skipped and returned as warnings.
+func (list ChapterList) Chapters(duration time.Duration) (chapters []Chapter, warnings []error) {
+	for _, chapter := range list {
+		switch {
+		case chapter.Start >= duration:
+			warnings = append(warnings, errors.Errorf("chapter %q starts after the end", chapter.Title))
+		case len(chapters) != 0 && chapter.Start <= chapters[len(chapters)-1].Start:
+			warnings = append(warnings, errors.Errorf("chapter %q is out of order", chapter.Title))
+		default:
+			if len(chapters) != 0 {
+				chapters[len(chapters)-1].End = chapter.Start
+			}
+			chapters = append(chapters, chapter)
+		}
+	}
+	if len(chapters) != 0 {
+		chapters[len(chapters)-1].End = duration
+	}
+	return
+}
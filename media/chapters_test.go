@@ -0,0 +1,201 @@
+package media
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCue(t *testing.T) {
+	const sheet = "\ufeffREM GENRE Podcast\r\n" +
+		`PERFORMER "The Show"
+TITLE "Episode 12"
+FILE "episode 12.wav" WAVE
+  TRACK 01 AUDIO
+    TITLE "Intro"
+    INDEX 01 00:00:00
+  TRACK 02 AUDIO
+    TITLE "Interview: Guest's story"
+    PERFORMER Guest
+    INDEX 00 12:29:00
+    INDEX 01 12:30:37
+  TRACK 3 AUDIO
+    TITLE "Unterminated quote
+    INDEX 01 75:00:74
+`
+	got, err := ParseCue(strings.NewReader(sheet))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &CueSheet{
+		Title:     "Episode 12",
+		Performer: "The Show",
+		File:      "episode 12.wav",
+		Tracks: []CueTrack{
+			{Number: 1, Title: "Intro", Start: 0},
+			{Number: 2, Title: "Interview: Guest's story", Performer: "Guest", Start: 12*time.Minute + 30*time.Second + 37*time.Second/75},
+			{Number: 3, Title: "Unterminated quote", Start: 75*time.Minute + 74*time.Second/75},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestParseCueErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		sheet string
+	}{
+		{"two files", "FILE a.wav WAVE\nFILE b.wav WAVE\n"},
+		{"no track number", "FILE a.wav WAVE\nTRACK\n"},
+		{"bad track number", "FILE a.wav WAVE\nTRACK one AUDIO\n"},
+		{"no index", "FILE a.wav WAVE\nTRACK 01 AUDIO\nINDEX 00 00:00:00\n"},
+		{"bad position", "FILE a.wav WAVE\nTRACK 01 AUDIO\nINDEX 01 00:00\n"},
+		{"negative position", "FILE a.wav WAVE\nTRACK 01 AUDIO\nINDEX 01 00:-1:00\n"},
+		{"text position", "FILE a.wav WAVE\nTRACK 01 AUDIO\nINDEX 01 aa:bb:cc\n"},
+	}
+	for _, tt := range tests {
+		if sheet, err := ParseCue(strings.NewReader(tt.sheet)); err == nil {
+			t.Errorf("%s: got %+v, want an error", tt.name, sheet)
+		}
+	}
+}
+
+func TestCueChapters(t *testing.T) {
+	sheet := &CueSheet{Tracks: []CueTrack{
+		{Number: 1, Title: "One", Start: 0},
+		{Number: 2, Title: "Two", Start: time.Minute},
+	}}
+	got, err := sheet.Chapters(3 * time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Chapter{
+		{Start: 0, End: time.Minute, Title: "One"},
+		{Start: time.Minute, End: 3 * time.Minute, Title: "Two"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	if _, err := sheet.Chapters(time.Minute); err == nil {
+		t.Error("the last track past the end is accepted")
+	}
+	sheet.Tracks[1].Start = 0
+	if _, err := sheet.Chapters(3 * time.Minute); err == nil {
+		t.Error("the tracks out of order are accepted")
+	}
+	if got, err := (&CueSheet{}).Chapters(time.Minute); err != nil || len(got) != 0 {
+		t.Errorf("empty sheet: %v, %v", got, err)
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{in: "01:02", want: time.Minute + 2*time.Second},
+		{in: "1:02:03", want: time.Hour + 2*time.Minute + 3*time.Second},
+		{in: "00:00:01.5", want: 1500 * time.Millisecond},
+		{in: "90:00", want: 90 * time.Minute},
+		{in: "12", wantErr: true},
+		{in: "1:2:3:4", wantErr: true},
+		{in: "01:60", wantErr: true},
+		{in: "01:60:00", wantErr: true},
+		{in: "1.5:00", wantErr: true},
+		{in: "-1:00", wantErr: true},
+		{in: "aa:bb", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseTimestamp(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseTimestamp(%q) = %v, %v, want %v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseChapterList(t *testing.T) {
+	const list = "\ufeff# show notes\r\n" +
+		"00:00 Intro\n" +
+		"\n" +
+		"  01:30\tNews  \n" +
+		"1:02:03.250 Interview: part 1\n" +
+		"1:75 Broken\n" +
+		"Outro\n" +
+		"1:10:00\n"
+	got, warnings, err := ParseChapterList(strings.NewReader(list))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ChapterList{
+		{Start: 0, Title: "Intro"},
+		{Start: 90 * time.Second, Title: "News"},
+		{Start: time.Hour + 2*time.Minute + 3250*time.Millisecond, Title: "Interview: part 1"},
+		{Start: 70 * time.Minute},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+	if len(warnings) != 2 || !strings.HasPrefix(warnings[0].Error(), "line 6:") || !strings.HasPrefix(warnings[1].Error(), "line 7:") {
+		t.Errorf("warnings %v, want lines 6 and 7", warnings)
+	}
+}
+
+func TestParseChapterJSON(t *testing.T) {
+	got, warnings, err := ParseChapterJSON(strings.NewReader(`[
+		{"start": "00:00", "title": "Intro"},
+		{"start": "bad", "title": "Broken"},
+		{"start": "05:00.5"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ChapterList{
+		{Start: 0, Title: "Intro"},
+		{Start: 5*time.Minute + 500*time.Millisecond},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if len(warnings) != 1 || !strings.HasPrefix(warnings[0].Error(), "chapter 2:") {
+		t.Errorf("warnings %v, want chapter 2", warnings)
+	}
+
+	for _, invalid := range []string{``, `{"start": "00:00"}`, `[{"start": 5}]`, `[`} {
+		if _, _, err := ParseChapterJSON(strings.NewReader(invalid)); err == nil {
+			t.Errorf("ParseChapterJSON(%q) accepted", invalid)
+		}
+	}
+}
+
+func TestChapterListChapters(t *testing.T) {
+	list := ChapterList{
+		{Start: 0, Title: "One"},
+		{Start: time.Minute, Title: "Two"},
+		{Start: 30 * time.Second, Title: "Back"},
+		{Start: time.Minute, Title: "Same"},
+		{Start: 2 * time.Minute, Title: "Three"},
+		{Start: 5 * time.Minute, Title: "Past"},
+	}
+	got, warnings := list.Chapters(3 * time.Minute)
+	want := []Chapter{
+		{Start: 0, End: time.Minute, Title: "One"},
+		{Start: time.Minute, End: 2 * time.Minute, Title: "Two"},
+		{Start: 2 * time.Minute, End: 3 * time.Minute, Title: "Three"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+	if len(warnings) != 3 {
+		t.Errorf("warnings %v, want 3", warnings)
+	}
+
+	if got, warnings := (ChapterList{}).Chapters(time.Minute); got != nil || warnings != nil {
+		t.Errorf("empty list: %v, %v", got, warnings)
+	}
+}
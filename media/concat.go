@@ -0,0 +1,138 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// escapeFFMetadata escapes the special characters of the ffmetadata format
+func escapeFFMetadata(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '=', ';', '#', '\\', '\n':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// FFMetadata returns the tags and the chapters in the ffmpeg's metadata file
+// format.
+func FFMetadata(tags map[string]string, chapters []Chapter) string {
+	var b strings.Builder
+	b.WriteString(";FFMETADATA1\n")
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s=%s\n", escapeFFMetadata(key), escapeFFMetadata(tags[key]))
+	}
+	for _, chapter := range chapters {
+		fmt.Fprintf(&b, "[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\n",
+			chapter.Start.Milliseconds(), chapter.End.Milliseconds(),
+		)
+		if chapter.Title != "" {
+			fmt.Fprintf(&b, "title=%s\n", escapeFFMetadata(chapter.Title))
+		}
+	}
+	return b.String()
+}
+
+// writeTemp writes the data into a temporary file next to the file path
+func writeTemp(path, pattern, data string) (string, error) {
+	f, err := ioutil.TempFile(filepath.Dir(path), pattern)
+	if err != nil {
+		return "", err
+	}
+	_, err = f.WriteString(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// concatList returns the list of the inputs for the concat demuxer. It
+// resolves the relative paths against the folder of the list, so the paths
+// are made absolute.
+func concatList(inputs []string) (string, error) {
+	var list strings.Builder
+	for _, input := range inputs {
+		path, err := filepath.Abs(input)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&list, "file '%s'\n", strings.Replace(path, "'", `'\''`, -1))
+	}
+	return list.String(), nil
+}
+
+// Concat joins the inputs into out, setting the tags and the chapters if the
+// format of out holds them, see CanEmbed.
+// If format is empty the audio is copied, so the inputs must have the same
+// codec and parameters, otherwise it's encoded in the format.
+func Concat(ctx context.Context, inputs []string, out string, tags map[string]string, chapters []Chapter, format string, progress Progress) (err error) {
+	embedded := chapters
+	if !CanEmbed(out) {
+		embedded = nil
+	}
+	metaFile, err := writeTemp(out, "*.ffmetadata", FFMetadata(tags, embedded))
+	if err != nil {
+		return
+	}
+	defer os.Remove(metaFile)
+
+	args := []string{FFmpeg, "-hide_banner", "-nostdin", "-y"}
+	if format == "" {
+		list, err := concatList(inputs)
+		if err != nil {
+			return err
+		}
+		listFile, err := writeTemp(out, "*.concat", list)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(listFile)
+		args = append(args,
+			"-f", "concat", "-safe", "0", "-i", listFile, "-i", metaFile,
+			"-map", "0:a", "-map_metadata", "1", "-map_chapters", "1", "-c", "copy",
+		)
+	} else {
+		encoder, err := encoderArgs(format)
+		if err != nil {
+			return err
+		}
+		var filter strings.Builder
+		for i, input := range inputs {
+			args = append(args, "-i", input)
+			fmt.Fprintf(&filter, "[%d:a:0]", i)
+		}
+		fmt.Fprintf(&filter, "concat=n=%d:v=0:a=1[a]", len(inputs))
+		meta := fmt.Sprint(len(inputs))
+		args = append(args, "-i", metaFile,
+			"-filter_complex", filter.String(), "-map", "[a]",
+			"-map_metadata", meta, "-map_chapters", meta,
+		)
+		args = append(args, encoder...)
+	}
+
+	var duration time.Duration
+	if len(chapters) != 0 {
+		duration = chapters[len(chapters)-1].End
+	}
+	_, err = run(ctx, append(args, out), duration, progress, nil)
+	return err
+}
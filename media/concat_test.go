@@ -0,0 +1,49 @@
+package media
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConcatList(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		inputs []string
+		want   string
+	}{
+		{"relative", []string{"a.mp3", "sub/b.mp3"},
+			"file '" + filepath.Join(wd, "a.mp3") + "'\nfile '" + filepath.Join(wd, "sub/b.mp3") + "'\n"},
+		{"absolute", []string{"/podcasts/a.mp3"}, "file '/podcasts/a.mp3'\n"},
+		{"quote", []string{"/podcasts/it's.mp3"}, `file '/podcasts/it'\''s.mp3'` + "\n"},
+		{"clean", []string{"/podcasts/./x/../a.mp3"}, "file '/podcasts/a.mp3'\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := concatList(tt.inputs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFFMetadata(t *testing.T) {
+	got := FFMetadata(map[string]string{"title": "A=B;C"}, []Chapter{
+		{Start: 0, End: 1500e6, Title: "One #1"},
+		{Start: 1500e6, End: 3000e6},
+	})
+	want := ";FFMETADATA1\ntitle=A\\=B\\;C\n" +
+		"[CHAPTER]\nTIMEBASE=1/1000\nSTART=0\nEND=1500\ntitle=One \\#1\n" +
+		"[CHAPTER]\nTIMEBASE=1/1000\nSTART=1500\nEND=3000\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
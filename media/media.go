@@ -0,0 +1,265 @@
+// Package media prepares audio files for the upload using external tools,
+// ffmpeg by default.
+//
+// The tools are described by command line templates, so any
+// ffmpeg-compatible tool can be used instead. The progress is parsed from
+// ffmpeg-style output, other tools just don't report it.
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// The external tools used when no command is given
+var (
+	FFmpeg  = "ffmpeg"
+	FFprobe = "ffprobe"
+)
+
+// Command is a command line template. Arguments like {in} and {out} are
+// replaced with the actual values when the command is run.
+type Command []string
+
+// ParseCommand splits the command line into arguments. Arguments can be
+// quoted with single or double quotes, backslash escapes the next character
+// outside of single quotes.
+func ParseCommand(s string) (Command, error) {
+	var (
+		cmd     Command
+		arg     strings.Builder
+		inArg   bool
+		quote   rune
+		escaped bool
+	)
+	for _, r := range s {
+		switch {
+		case escaped:
+			arg.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				cmd = append(cmd, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errors.Errorf("unterminated quote in command %q", s)
+	}
+	if inArg {
+		cmd = append(cmd, arg.String())
+	}
+	if len(cmd) == 0 {
+		return nil, errors.New("empty command")
+	}
+	return cmd, nil
+}
+
+// String returns the command line, quoting the arguments if needed.
+func (c Command) String() string {
+	args := make([]string, len(c))
+	for i, arg := range c {
+		if arg == "" || strings.ContainsAny(arg, " \t\n'\"\\") {
+			arg = "'" + strings.Replace(arg, "'", `'"'"'`, -1) + "'"
+		}
+		args[i] = arg
+	}
+	return strings.Join(args, " ")
+}
+
+// Expand returns the arguments with the {name} placeholders replaced by
+// vars[name]. An argument that is exactly {name} with a list value is
+// replaced by all of the values.
+func (c Command) Expand(vars map[string][]string) []string {
+	var args []string
+	for _, arg := range c {
+		if strings.HasPrefix(arg, "{") && strings.HasSuffix(arg, "}") {
+			if values, found := vars[arg[1:len(arg)-1]]; found {
+				args = append(args, values...)
+				continue
+			}
+		}
+		for name, values := range vars {
+			if len(values) == 1 {
+				arg = strings.Replace(arg, "{"+name+"}", values[0], -1)
+			}
+		}
+		args = append(args, arg)
+	}
+	return args
+}
+
+// placeholderRe matches the {name} placeholders of the command templates
+var placeholderRe = regexp.MustCompile(`\{(\w+)\}`)
+
+// Check returns an error if the command has a placeholder that isn't one
+// of the names or lacks one of them.
+func (c Command) Check(names ...string) error {
+	known := make(map[string]bool, len(names))
+	for _, name := range names {
+		known[name] = true
+	}
+	used := make(map[string]bool)
+	for _, arg := range c {
+		for _, m := range placeholderRe.FindAllStringSubmatch(arg, -1) {
+			if !known[m[1]] {
+				return errors.Errorf("unknown placeholder {%s}", m[1])
+			}
+			used[m[1]] = true
+		}
+	}
+	for _, name := range names {
+		if !used[name] {
+			return errors.Errorf("placeholder {%s} is missing", name)
+		}
+	}
+	return nil
+}
+
+// Progress is called with the fraction of the work done, from 0 to 1.
+type Progress func(done float64)
+
+// ToolError is returned when an external tool fails.
+type ToolError struct {
+	Tool string
+	Err  error
+	// Output is the tail of the tool's error output
+	Output string
+}
+
+func (e *ToolError) Error() string {
+	if e.Output == "" {
+		return fmt.Sprintf("%s failed: %s", e.Tool, e.Err)
+	}
+	return fmt.Sprintf("%s failed: %s: %s", e.Tool, e.Err, e.Output)
+}
+
+func (e *ToolError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	durationRe = regexp.MustCompile(`Duration: (\d+:\d+:\d+(?:\.\d+)?)`)
+	timeRe     = regexp.MustCompile(`time=\s*(\d+:\d+:\d+(?:\.\d+)?)`)
+)
+
+// parseClock parses ffmpeg's HH:MM:SS.ss timestamps
+func parseClock(s string) (time.Duration, bool) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, false
+	}
+	h, err1 := strconv.Atoi(parts[0])
+	m, err2 := strconv.Atoi(parts[1])
+	sec, err3 := strconv.ParseFloat(parts[2], 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return 0, false
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute +
+		time.Duration(sec*float64(time.Second)), true
+}
+
+// splitLines is a bufio.SplitFunc for both \n and \r terminated lines,
+// ffmpeg updates its progress line with \r
+func splitLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// outputTail is the number of the last output lines kept for the errors
+const outputTail = 2
+
+// run runs the tool and reports the progress parsed from its output.
+// duration is the expected length of the output, if it's zero it's parsed
+// from the output as well. onLine, if set, is called with every line of the
+// error output.
+func run(ctx context.Context, args []string, duration time.Duration, progress Progress, onLine func(line string)) (stdout []byte, err error) {
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, &ToolError{Tool: args[0], Err: err}
+	}
+
+	var tail []string
+	scanner := bufio.NewScanner(stderr)
+	scanner.Split(splitLines)
+	for scanner.Scan() {
+		raw := scanner.Text()
+		line := strings.TrimSpace(raw)
+		if line == "" {
+			continue
+		}
+		if onLine != nil {
+			onLine(line)
+		}
+		if duration == 0 {
+			if m := durationRe.FindStringSubmatch(line); m != nil {
+				duration, _ = parseClock(m[1])
+			}
+		}
+		if m := timeRe.FindStringSubmatch(line); m != nil {
+			if done, ok := parseClock(m[1]); ok && duration > 0 && progress != nil {
+				progress(float64(done) / float64(duration))
+			}
+			continue
+		}
+		if raw[0] == ' ' || raw[0] == '\t' {
+			// details of the input and output files
+			continue
+		}
+		tail = append(tail, line)
+		if len(tail) > outputTail {
+			tail = tail[1:]
+		}
+	}
+
+	err = cmd.Wait()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, &ToolError{Tool: args[0], Err: err, Output: strings.Join(tail, "; ")}
+	}
+	if progress != nil {
+		progress(1)
+	}
+	return out.Bytes(), nil
+}
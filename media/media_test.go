@@ -0,0 +1,133 @@
+package media
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Command
+	}{
+		{"ffmpeg -i {in} {out}", Command{"ffmpeg", "-i", "{in}", "{out}"}},
+		{"  ffmpeg \t -i  {in}\n{out} ", Command{"ffmpeg", "-i", "{in}", "{out}"}},
+		{`enc --title 'My Show' {in} {out}`, Command{"enc", "--title", "My Show", "{in}", "{out}"}},
+		{`enc "a 'b' c" 'd "e"'`, Command{"enc", `a 'b' c`, `d "e"`}},
+		{`enc a\ b \"c\" 'x\y'`, Command{"enc", "a b", `"c"`, `x\y`}},
+		{`enc "a \" b"`, Command{"enc", `a " b`}},
+		{`enc '' ""`, Command{"enc", "", ""}},
+		{`enc pre{in}post`, Command{"enc", "pre{in}post"}},
+		{`enc a"b c"d`, Command{"enc", "ab cd"}},
+	}
+	for _, tt := range tests {
+		got, err := ParseCommand(tt.in)
+		if err != nil {
+			t.Errorf("ParseCommand(%q): %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseCommand(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		// String quotes the arguments back
+		again, err := ParseCommand(got.String())
+		if err != nil || !reflect.DeepEqual(again, got) {
+			t.Errorf("%q.String() = %q parses into %q, %v", got, got.String(), again, err)
+		}
+	}
+}
+
+func TestParseCommandErrors(t *testing.T) {
+	for _, in := range []string{"", "   ", `enc 'a`, `enc "a`, `enc a\`} {
+		if cmd, err := ParseCommand(in); err == nil {
+			t.Errorf("ParseCommand(%q) = %q, want an error", in, cmd)
+		}
+	}
+}
+
+func TestCommandCheck(t *testing.T) {
+	tests := []struct {
+		cmd     Command
+		wantErr string
+	}{
+		{Command{"ffmpeg", "-i", "{in}", "{out}"}, ""},
+		{Command{"enc", "--in={in}", "-o", "dir/{out}.tmp"}, ""},
+		{Command{"enc", "{in}", "{in}", "{out}"}, ""},
+		{Command{"enc", "{in}", "{output}"}, "unknown placeholder {output}"},
+		{Command{"enc", "{name}", "{in}", "{out}"}, "unknown placeholder {name}"},
+		{Command{"enc", "{in}"}, "placeholder {out} is missing"},
+		{Command{"enc", "-"}, "placeholder {in} is missing"},
+		// not placeholders
+		{Command{"enc", "{in}", "{out}", "{}", "{a b}"}, ""},
+	}
+	for _, tt := range tests {
+		err := tt.cmd.Check("in", "out")
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%q: unexpected error %v", tt.cmd, err)
+		case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+			t.Errorf("%q: got %v, want %q", tt.cmd, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCommandExpand(t *testing.T) {
+	vars := map[string][]string{
+		"in":     {"/tmp/a b.flac"},
+		"out":    {"/tmp/out.m4a"},
+		"inputs": {"1.mp3", "2.mp3"},
+		"none":   {},
+	}
+	tests := []struct {
+		cmd  Command
+		want []string
+	}{
+		{Command{"ffmpeg", "-i", "{in}", "{out}"}, []string{"ffmpeg", "-i", "/tmp/a b.flac", "/tmp/out.m4a"}},
+		{Command{"enc", "--in={in}", "{out}.part"}, []string{"enc", "--in=/tmp/a b.flac", "/tmp/out.m4a.part"}},
+		{Command{"cat", "{inputs}"}, []string{"cat", "1.mp3", "2.mp3"}},
+		{Command{"cat", "{none}", "x"}, []string{"cat", "x"}},
+		// a list only replaces the whole argument
+		{Command{"cat", "-{inputs}"}, []string{"cat", "-{inputs}"}},
+		{Command{"enc", "{unknown}"}, []string{"enc", "{unknown}"}},
+	}
+	for _, tt := range tests {
+		if got := tt.cmd.Expand(vars); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q.Expand() = %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultTranscodeCommand(t *testing.T) {
+	for _, format := range Formats {
+		cmd, err := DefaultTranscodeCommand(format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = cmd.Check("in", "out"); err != nil {
+			t.Errorf("%s: %v", format, err)
+		}
+	}
+	if _, err := DefaultTranscodeCommand("flac"); err == nil {
+		t.Error("flac is supported")
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"00:00:01.50", 1500 * time.Millisecond, true},
+		{"01:02:03", time.Hour + 2*time.Minute + 3*time.Second, true},
+		{"1:2", 0, false},
+		{"aa:00:00", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseClock(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseClock(%q) = %v, %v, want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package media
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The loudnorm limits besides the target loudness, the EBU R128 defaults
+const (
+	loudnormTruePeak = -1.5
+	loudnormRange    = 11
+)
+
+// Loudness is the loudness of a file measured by ffmpeg's loudnorm filter.
+type Loudness struct {
+	// Integrated loudness in LUFS
+	Integrated float64
+	// TruePeak in dBTP
+	TruePeak float64
+	// Range is the loudness range in LU
+	Range     float64
+	Threshold float64
+	// Offset is the gain the second pass needs to hit the target exactly
+	Offset float64
+}
+
+// loudnormOutput collects the JSON loudnorm prints at the end
+type loudnormOutput struct {
+	lines  []string
+	inJSON bool
+}
+
+func (o *loudnormOutput) onLine(line string) {
+	switch {
+	case line == "{":
+		o.lines = []string{line}
+		o.inJSON = true
+	case o.inJSON:
+		o.lines = append(o.lines, line)
+		o.inJSON = line != "}"
+	}
+}
+
+// parse returns the input and the output loudness
+func (o *loudnormOutput) parse() (input, output *Loudness, err error) {
+	var values map[string]string
+	if err = json.Unmarshal([]byte(strings.Join(o.lines, "\n")), &values); err != nil || len(values) == 0 {
+		return nil, nil, errors.New("loudnorm didn't report the loudness")
+	}
+	get := func(key string) float64 {
+		if err != nil {
+			return 0
+		}
+		var value float64
+		value, err = strconv.ParseFloat(values[key], 64)
+		if err != nil {
+			err = errors.Errorf("invalid loudnorm %s %q", key, values[key])
+		}
+		return value
+	}
+	input = &Loudness{
+		Integrated: get("input_i"),
+		TruePeak:   get("input_tp"),
+		Range:      get("input_lra"),
+		Threshold:  get("input_thresh"),
+		Offset:     get("target_offset"),
+	}
+	output = &Loudness{
+		Integrated: get("output_i"),
+		TruePeak:   get("output_tp"),
+		Range:      get("output_lra"),
+		Threshold:  get("output_thresh"),
+	}
+	return
+}
+
+// MeasureLoudness is the first pass of the normalization to the target
+// loudness in LUFS, it has to decode the whole file.
+func MeasureLoudness(ctx context.Context, file string, target float64, progress Progress) (*Loudness, error) {
+	var output loudnormOutput
+	_, err := run(ctx, []string{
+		FFmpeg, "-hide_banner", "-nostdin", "-i", file, "-map", "0:a:0",
+		"-af", fmt.Sprintf("loudnorm=I=%g:TP=%g:LRA=%g:print_format=json", target, float64(loudnormTruePeak), float64(loudnormRange)),
+		"-f", "null", "-",
+	}, 0, progress, output.onLine)
+	if err != nil {
+		return nil, err
+	}
+	input, _, err := output.parse()
+	return input, err
+}
+
+// Normalize is the second pass of the normalization, it encodes the file
+// into out with the loudness corrected using the first pass measurement.
+// The format of out is chosen by its extension, the tags and the artwork
+// are kept. Returns the loudness of out.
+func Normalize(ctx context.Context, in, out string, target float64, measured *Loudness, progress Progress) (*Loudness, error) {
+	ext := strings.ToLower(filepath.Ext(out))
+	encoder, err := encoderForExt(ext)
+	if err != nil {
+		return nil, err
+	}
+	info, err := Probe(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{
+		FFmpeg, "-hide_banner", "-nostdin", "-y", "-i", in, "-map", "0:a:0",
+		"-af", fmt.Sprintf(
+			"loudnorm=I=%g:TP=%g:LRA=%g:measured_I=%g:measured_TP=%g:measured_LRA=%g:measured_thresh=%g:offset=%g:linear=true:print_format=json",
+			target, float64(loudnormTruePeak), float64(loudnormRange),
+			measured.Integrated, measured.TruePeak, measured.Range, measured.Threshold, measured.Offset,
+		),
+		"-map_metadata", "0",
+	}
+	if CanEmbed(out) {
+		args = append(args, "-map", "0:v?", "-c:v", "copy", "-disposition:v", "attached_pic")
+	}
+	if info.SampleRate != 0 {
+		// loudnorm upsamples to 192 kHz
+		args = append(args, "-ar", strconv.Itoa(info.SampleRate))
+	}
+	args = append(args, encoder...)
+
+	var output loudnormOutput
+	_, err = run(ctx, append(args, out), info.Duration, progress, output.onLine)
+	if err != nil {
+		return nil, err
+	}
+	_, result, err := output.parse()
+	return result, err
+}
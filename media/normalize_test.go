@@ -0,0 +1,83 @@
+package media
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+const loudnormJSON = `[Parsed_loudnorm_0 @ 0x7f8e1c004a00] 
+{
+	"input_i" : "-27.61",
+	"input_tp" : "-4.47",
+	"input_lra" : "18.06",
+	"input_thresh" : "-39.20",
+	"output_i" : "-16.58",
+	"output_tp" : "-1.50",
+	"output_lra" : "14.78",
+	"output_thresh" : "-27.71",
+	"normalization_type" : "dynamic",
+	"target_offset" : "0.58"
+}`
+
+// loudnormLines feeds the ffmpeg output to the parser line by line
+func loudnormLines(text string) *loudnormOutput {
+	var output loudnormOutput
+	for _, line := range strings.Split(text, "\n") {
+		output.onLine(strings.TrimSpace(line))
+	}
+	return &output
+}
+
+func TestLoudnormParse(t *testing.T) {
+	input, output, err := loudnormLines("size=N/A time=00:01:00.00 bitrate=N/A speed= 450x\n" + loudnormJSON + "\n").parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantInput := Loudness{Integrated: -27.61, TruePeak: -4.47, Range: 18.06, Threshold: -39.2, Offset: 0.58}
+	wantOutput := Loudness{Integrated: -16.58, TruePeak: -1.5, Range: 14.78, Threshold: -27.71}
+	if *input != wantInput || *output != wantOutput {
+		t.Errorf("got %+v, %+v, want %+v, %+v", *input, *output, wantInput, wantOutput)
+	}
+}
+
+func TestLoudnormParseSilence(t *testing.T) {
+	silent := strings.NewReplacer(`"-27.61"`, `"-inf"`, `"-4.47"`, `"-inf"`).Replace(loudnormJSON)
+	input, _, err := loudnormLines(silent).parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !math.IsInf(input.Integrated, -1) || !math.IsInf(input.TruePeak, -1) {
+		t.Errorf("got %+v, want -inf", *input)
+	}
+}
+
+func TestLoudnormParseLast(t *testing.T) {
+	first := strings.Replace(loudnormJSON, `"-27.61"`, `"-10"`, 1)
+	input, _, err := loudnormLines(first + "\n" + loudnormJSON).parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if input.Integrated != -27.61 {
+		t.Errorf("got %v, want the last report", input.Integrated)
+	}
+}
+
+func TestLoudnormParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+	}{
+		{"nothing", "Output #0, null, to 'pipe:':\n"},
+		{"empty object", "{\n}"},
+		{"unterminated", "{\n\"input_i\" : \"-27.61\","},
+		{"missing value", strings.Replace(loudnormJSON, `"target_offset" : "0.58"`, `"other" : "1"`, 1)},
+		{"not a number", strings.Replace(loudnormJSON, `"-4.47"`, `"loud"`, 1)},
+		{"not a string", strings.Replace(loudnormJSON, `"-4.47"`, `-4.47`, 1)},
+	}
+	for _, tt := range tests {
+		if input, _, err := loudnormLines(tt.output).parse(); err == nil {
+			t.Errorf("%s: got %+v, want an error", tt.name, input)
+		}
+	}
+}
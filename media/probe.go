@@ -0,0 +1,103 @@
+package media
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Info is the information about a media file reported by ffprobe.
+type Info struct {
+	Duration time.Duration
+	// BitRate in bits per second, 0 if unknown
+	BitRate int64
+	// Tags of the file, the keys are lowercase
+	Tags map[string]string
+	// Chapters embedded in the file
+	Chapters []Chapter
+	// Codec, SampleRate and Channels describe the first audio stream
+	Codec      string
+	SampleRate int
+	Channels   int
+	// Artwork is set if the file has an attached picture
+	Artwork bool
+}
+
+// Probe returns the information about the file.
+func Probe(ctx context.Context, file string) (*Info, error) {
+	out, err := run(ctx, []string{
+		FFprobe, "-v", "error", "-print_format", "json",
+		"-show_entries", "format=duration,bit_rate:format_tags:stream=codec_type,codec_name,sample_rate,channels:stream_disposition=attached_pic",
+		"-show_chapters",
+		file,
+	}, 0, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var probe struct {
+		Format struct {
+			Duration string            `json:"duration"`
+			BitRate  string            `json:"bit_rate"`
+			Tags     map[string]string `json:"tags"`
+		} `json:"format"`
+		Streams []struct {
+			CodecType   string `json:"codec_type"`
+			CodecName   string `json:"codec_name"`
+			SampleRate  string `json:"sample_rate"`
+			Channels    int    `json:"channels"`
+			Disposition struct {
+				AttachedPic int `json:"attached_pic"`
+			} `json:"disposition"`
+		} `json:"streams"`
+		Chapters []struct {
+			StartTime string            `json:"start_time"`
+			EndTime   string            `json:"end_time"`
+			Tags      map[string]string `json:"tags"`
+		} `json:"chapters"`
+	}
+	err = json.Unmarshal(out, &probe)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't parse ffprobe output")
+	}
+
+	info := &Info{Tags: make(map[string]string)}
+	seconds, err := strconv.ParseFloat(probe.Format.Duration, 64)
+	if err != nil || seconds <= 0 {
+		return nil, errors.New("unknown duration")
+	}
+	info.Duration = time.Duration(seconds * float64(time.Second))
+	info.BitRate, _ = strconv.ParseInt(probe.Format.BitRate, 10, 64)
+	audio := false
+	for _, stream := range probe.Streams {
+		switch {
+		case stream.CodecType == "audio" && !audio:
+			audio = true
+			info.Codec = stream.CodecName
+			info.SampleRate, _ = strconv.Atoi(stream.SampleRate)
+			info.Channels = stream.Channels
+		case stream.CodecType == "video" && stream.Disposition.AttachedPic != 0:
+			info.Artwork = true
+		}
+	}
+	for key, value := range probe.Format.Tags {
+		info.Tags[strings.ToLower(key)] = value
+	}
+	for _, ch := range probe.Chapters {
+		start, err1 := strconv.ParseFloat(ch.StartTime, 64)
+		end, err2 := strconv.ParseFloat(ch.EndTime, 64)
+		if err1 != nil || err2 != nil || end <= start {
+			return nil, errors.New("invalid chapters")
+		}
+		info.Chapters = append(info.Chapters, Chapter{
+			Start: time.Duration(start * float64(time.Second)),
+			End:   time.Duration(end * float64(time.Second)),
+			Title: ch.Tags["title"],
+		})
+	}
+	return info, nil
+}
@@ -0,0 +1,411 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The containers recognized by Sniff
+const (
+	ContainerMP3  = "mp3"
+	ContainerADTS = "aac"
+	ContainerMP4  = "mp4"
+	ContainerWAV  = "wav"
+)
+
+// ErrNotAudio is returned by Sniff for the files of unknown formats
+var ErrNotAudio = errors.New("not an audio file")
+
+// Header is what's known about the file from its headers, it's read without
+// the external tools.
+type Header struct {
+	Container string
+	// Duration is zero if unknown
+	Duration time.Duration
+	// BitRate in bits per second, 0 if unknown
+	BitRate int64
+}
+
+// sniffSize is the size of the beginning of the file searched for the
+// first audio frame
+const sniffSize = 64 << 10
+
+// Sniff reads the headers of the file, returns ErrNotAudio if the format
+// isn't recognized, or an error describing why the file is corrupt.
+func Sniff(file string) (*Header, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := stat.Size()
+	if size == 0 {
+		return nil, errors.New("empty file")
+	}
+
+	head := make([]byte, sniffSize)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	head = head[:n]
+
+	switch {
+	case len(head) >= 12 && string(head[4:8]) == "ftyp":
+		return sniffMP4(f, size)
+	case len(head) >= 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "WAVE":
+		return sniffWAV(f, size)
+	}
+
+	// mp3 and aac streams can start with an ID3v2 tag
+	start := int64(0)
+	if len(head) >= 10 && string(head[:3]) == "ID3" {
+		tagSize := int64(head[6]&0x7f)<<21 | int64(head[7]&0x7f)<<14 | int64(head[8]&0x7f)<<7 | int64(head[9]&0x7f)
+		start = 10 + tagSize
+		if head[5]&0x10 != 0 {
+			// footer
+			start += 10
+		}
+		if start >= size {
+			return nil, errors.New("only an ID3 tag, no audio")
+		}
+		head = head[:cap(head)]
+		n, err = f.ReadAt(head, start)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		head = head[:n]
+	}
+	for i := 0; i+4 <= len(head); i++ {
+		if head[i] != 0xff {
+			continue
+		}
+		if header, ok := sniffMP3(head[i:], start+int64(i), size, f); ok {
+			return header, nil
+		}
+		if header, ok := sniffADTS(head[i:], start+int64(i), size); ok {
+			return header, nil
+		}
+	}
+	return nil, ErrNotAudio
+}
+
+// playTime returns the duration of the data at the bitrate
+func playTime(size, bitRate int64) time.Duration {
+	return time.Duration(float64(size) * 8 / float64(bitRate) * float64(time.Second))
+}
+
+// bitRate returns the bitrate of the data playing for the duration
+func bitRate(size int64, duration time.Duration) int64 {
+	return int64(float64(size) * 8 / duration.Seconds())
+}
+
+// mp3Frame is the parsed MPEG audio frame header
+type mp3Frame struct {
+	version    int // 1, 2 or 25 for 2.5
+	layer      int
+	bitRate    int64 // bits per second
+	sampleRate int
+	mono       bool
+	length     int
+}
+
+var (
+	mp3BitRates = [2][3][16]int64{
+		// MPEG-1 layers I, II, III
+		{
+			{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+			{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+		},
+		// MPEG-2 and 2.5 layers I, II, III
+		{
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		},
+	}
+	mp3SampleRates = map[int][3]int{
+		1:  {44100, 48000, 32000},
+		2:  {22050, 24000, 16000},
+		25: {11025, 12000, 8000},
+	}
+)
+
+// parseMP3Frame parses the frame header at the beginning of b
+func parseMP3Frame(b []byte) (frame mp3Frame, ok bool) {
+	if len(b) < 4 || b[0] != 0xff || b[1]&0xe0 != 0xe0 {
+		return
+	}
+	switch (b[1] >> 3) & 3 {
+	case 0:
+		frame.version = 25
+	case 2:
+		frame.version = 2
+	case 3:
+		frame.version = 1
+	default:
+		return
+	}
+	layer := int(b[1]>>1) & 3
+	if layer == 0 {
+		return
+	}
+	frame.layer = 4 - layer
+	bitRateIndex := b[2] >> 4
+	sampleRateIndex := (b[2] >> 2) & 3
+	if bitRateIndex == 0 || bitRateIndex == 15 || sampleRateIndex == 3 {
+		return
+	}
+	table := 0
+	if frame.version != 1 {
+		table = 1
+	}
+	frame.bitRate = mp3BitRates[table][frame.layer-1][bitRateIndex] * 1000
+	frame.sampleRate = mp3SampleRates[frame.version][sampleRateIndex]
+	padding := int(b[2]>>1) & 1
+	frame.mono = b[3]>>6 == 3
+
+	switch {
+	case frame.layer == 1:
+		frame.length = (12*int(frame.bitRate)/frame.sampleRate + padding) * 4
+	case frame.layer == 3 && frame.version != 1:
+		frame.length = 72*int(frame.bitRate)/frame.sampleRate + padding
+	default:
+		frame.length = 144*int(frame.bitRate)/frame.sampleRate + padding
+	}
+	return frame, frame.length > 4
+}
+
+// samples returns the number of samples in the frame
+func (frame mp3Frame) samples() int {
+	switch {
+	case frame.layer == 1:
+		return 384
+	case frame.layer == 3 && frame.version != 1:
+		return 576
+	}
+	return 1152
+}
+
+// sniffMP3 checks for an MP3 stream at b, two consecutive frames are needed
+// to tell it from random bytes. The duration is read from the Xing or VBRI
+// header of the first frame, or calculated for the constant bitrate.
+func sniffMP3(b []byte, offset, size int64, f io.ReaderAt) (*Header, bool) {
+	frame, ok := parseMP3Frame(b)
+	if !ok {
+		return nil, false
+	}
+	if offset+int64(frame.length)+4 <= size {
+		next := make([]byte, 4)
+		if _, err := f.ReadAt(next, offset+int64(frame.length)); err != nil {
+			return nil, false
+		}
+		if _, ok := parseMP3Frame(next); !ok {
+			return nil, false
+		}
+	}
+	header := &Header{Container: ContainerMP3, BitRate: frame.bitRate}
+
+	// the Xing header follows the side information of the first frame
+	sideInfo := 32
+	switch {
+	case frame.version == 1 && frame.mono:
+		sideInfo = 17
+	case frame.version != 1 && !frame.mono:
+		sideInfo = 17
+	case frame.version != 1:
+		sideInfo = 9
+	}
+	frames := -1
+	if xing := 4 + sideInfo; len(b) >= xing+12 && (string(b[xing:xing+4]) == "Xing" || string(b[xing:xing+4]) == "Info") {
+		if flags := binary.BigEndian.Uint32(b[xing+4:]); flags&1 != 0 {
+			frames = int(binary.BigEndian.Uint32(b[xing+8:]))
+		}
+	} else if vbri := 4 + 32; len(b) >= vbri+18 && string(b[vbri:vbri+4]) == "VBRI" {
+		frames = int(binary.BigEndian.Uint32(b[vbri+14:]))
+	}
+
+	audioSize := size - offset
+	tag := make([]byte, 3)
+	if _, err := f.ReadAt(tag, size-128); err == nil && string(tag) == "TAG" && audioSize > 128 {
+		// ID3v1 tag
+		audioSize -= 128
+	}
+	if frames >= 0 {
+		header.Duration = time.Duration(float64(frames) * float64(frame.samples()) / float64(frame.sampleRate) * float64(time.Second))
+		if header.Duration > 0 {
+			header.BitRate = bitRate(audioSize, header.Duration)
+		}
+	} else {
+		header.Duration = playTime(audioSize, frame.bitRate)
+	}
+	return header, true
+}
+
+// adtsSampleRates are indexed by the sampling frequency index
+var adtsSampleRates = []int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+// adtsFrame returns the length and the sample rate of the ADTS frame at b
+func adtsFrame(b []byte) (length, sampleRate int, ok bool) {
+	if len(b) < 7 || b[0] != 0xff || b[1]&0xf6 != 0xf0 {
+		return
+	}
+	rateIndex := int(b[2]>>2) & 0xf
+	if rateIndex >= len(adtsSampleRates) {
+		return
+	}
+	length = int(b[3]&3)<<11 | int(b[4])<<3 | int(b[5])>>5
+	return length, adtsSampleRates[rateIndex], length > 7
+}
+
+// sniffADTS checks for an ADTS AAC stream at b. The bitrate is estimated
+// from the frames at the beginning, the frames hold 1024 samples.
+func sniffADTS(b []byte, offset, size int64) (*Header, bool) {
+	var frames, total, sampleRate int
+	for i := 0; frames < 100; frames++ {
+		length, rate, ok := adtsFrame(b[i:])
+		if !ok {
+			break
+		}
+		sampleRate = rate
+		total += length
+		i += length
+		if i >= len(b) {
+			frames++
+			break
+		}
+	}
+	if frames < 2 && int64(total) < size-offset {
+		return nil, false
+	}
+	header := &Header{Container: ContainerADTS}
+	header.BitRate = int64(total) * 8 * int64(sampleRate) / int64(frames*1024)
+	header.Duration = playTime(size-offset, header.BitRate)
+	return header, true
+}
+
+// mp4Box reads the box header at the offset, returns its type and the
+// offsets of its contents and of the next box
+func mp4Box(f io.ReaderAt, offset, end int64) (boxType string, body, next int64, err error) {
+	buf := make([]byte, 16)
+	if _, err = f.ReadAt(buf[:8], offset); err != nil {
+		return "", 0, 0, errors.New("truncated box")
+	}
+	boxType = string(buf[4:8])
+	boxSize := int64(binary.BigEndian.Uint32(buf))
+	body = offset + 8
+	switch boxSize {
+	case 0:
+		boxSize = end - offset
+	case 1:
+		if _, err = f.ReadAt(buf[8:16], offset+8); err != nil {
+			return "", 0, 0, errors.New("truncated box")
+		}
+		boxSize = int64(binary.BigEndian.Uint64(buf[8:]))
+		body += 8
+	}
+	if boxSize < body-offset {
+		return "", 0, 0, errors.Errorf("invalid %q box", boxType)
+	}
+	next = offset + boxSize
+	if next > end {
+		return "", 0, 0, errors.Errorf("truncated %q box", boxType)
+	}
+	return boxType, body, next, nil
+}
+
+// findMP4Box returns the offsets of the contents of the first box of the
+// type between start and end
+func findMP4Box(f io.ReaderAt, start, end int64, boxType string) (body, next int64, err error) {
+	for offset := start; offset < end; offset = next {
+		var t string
+		t, body, next, err = mp4Box(f, offset, end)
+		if err != nil {
+			return
+		}
+		if t == boxType {
+			return
+		}
+	}
+	return 0, 0, errors.Errorf("no %q box", boxType)
+}
+
+// sniffMP4 reads the duration from the movie header. The "moov" box is
+// often written last, so a missing one means that the file is incomplete.
+func sniffMP4(f io.ReaderAt, size int64) (*Header, error) {
+	moov, moovEnd, err := findMP4Box(f, 0, size, "moov")
+	if err != nil {
+		return nil, err
+	}
+	mvhd, _, err := findMP4Box(f, moov, moovEnd, "mvhd")
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 32)
+	if _, err = f.ReadAt(buf, mvhd); err != nil {
+		return nil, errors.New("truncated \"mvhd\" box")
+	}
+	var timescale, duration uint64
+	if buf[0] == 1 {
+		timescale = uint64(binary.BigEndian.Uint32(buf[20:]))
+		duration = binary.BigEndian.Uint64(buf[24:])
+	} else {
+		timescale = uint64(binary.BigEndian.Uint32(buf[12:]))
+		duration = uint64(binary.BigEndian.Uint32(buf[16:]))
+	}
+	header := &Header{Container: ContainerMP4}
+	if timescale != 0 {
+		header.Duration = time.Duration(float64(duration) / float64(timescale) * float64(time.Second))
+	}
+	if header.Duration > 0 {
+		header.BitRate = bitRate(size, header.Duration)
+	}
+	return header, nil
+}
+
+// sniffWAV reads the format and the size of the data chunk
+func sniffWAV(f io.ReaderAt, size int64) (*Header, error) {
+	var byteRate int64
+	buf := make([]byte, 16)
+	for offset := int64(12); offset+8 <= size; {
+		if _, err := f.ReadAt(buf[:8], offset); err != nil {
+			return nil, err
+		}
+		chunkSize := int64(binary.LittleEndian.Uint32(buf[4:]))
+		switch {
+		case bytes.Equal(buf[:4], []byte("fmt ")):
+			if chunkSize < 16 {
+				return nil, errors.New("invalid \"fmt \" chunk")
+			}
+			if _, err := f.ReadAt(buf, offset+8); err != nil {
+				return nil, errors.New("truncated \"fmt \" chunk")
+			}
+			byteRate = int64(binary.LittleEndian.Uint32(buf[8:]))
+		case bytes.Equal(buf[:4], []byte("data")):
+			if byteRate == 0 {
+				return nil, errors.New("no \"fmt \" chunk before the data")
+			}
+			if offset+8+chunkSize > size {
+				return nil, errors.New("truncated data")
+			}
+			return &Header{
+				Container: ContainerWAV,
+				Duration:  playTime(chunkSize, byteRate*8),
+				BitRate:   byteRate * 8,
+			}, nil
+		}
+		// chunks are word aligned
+		offset += 8 + chunkSize + chunkSize&1
+	}
+	return nil, errors.New("no \"data\" chunk")
+}
@@ -0,0 +1,173 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// mp3Frames returns n MPEG-1 layer III frames of 128 kbps at 44.1 kHz,
+// 417 bytes each
+func mp3Frames(n int) []byte {
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x64})
+	return bytes.Repeat(frame, n)
+}
+
+// adtsFrames returns n ADTS frames of 200 bytes at 44.1 kHz
+func adtsFrames(n int) []byte {
+	frame := make([]byte, 200)
+	copy(frame, []byte{0xff, 0xf1, 0x50, 0x80, 200 >> 3, (200&7)<<5 | 0x1f, 0xfc})
+	return bytes.Repeat(frame, n)
+}
+
+// id3Tag returns an ID3v2 tag with size bytes of contents
+func id3Tag(size int) []byte {
+	tag := []byte{'I', 'D', '3', 3, 0, 0,
+		byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+	return append(tag, make([]byte, size)...)
+}
+
+// mp4Atom returns the box of the type with the contents
+func mp4Atom(boxType string, contents ...[]byte) []byte {
+	body := bytes.Join(contents, nil)
+	box := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(box, uint32(8+len(body)))
+	copy(box[4:], boxType)
+	return append(box, body...)
+}
+
+// mvhd returns the version 0 movie header
+func mvhd(timescale, duration uint32) []byte {
+	body := make([]byte, 100)
+	binary.BigEndian.PutUint32(body[12:], timescale)
+	binary.BigEndian.PutUint32(body[16:], duration)
+	return mp4Atom("mvhd", body)
+}
+
+// wavFile returns a WAV file with the chunks after the RIFF header
+func wavFile(chunks ...[]byte) []byte {
+	data := []byte("RIFF\x00\x00\x00\x00WAVE")
+	for _, chunk := range chunks {
+		data = append(data, chunk...)
+	}
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(data)-8))
+	return data
+}
+
+// wavChunk returns the chunk with the declared size and the contents
+func wavChunk(id string, size uint32, contents []byte) []byte {
+	chunk := make([]byte, 8, 8+len(contents))
+	copy(chunk, id)
+	binary.LittleEndian.PutUint32(chunk[4:], size)
+	return append(chunk, contents...)
+}
+
+// wavFmt returns the fmt chunk of 16-bit stereo PCM at 44.1 kHz
+func wavFmt() []byte {
+	fmt := make([]byte, 16)
+	binary.LittleEndian.PutUint16(fmt[0:], 1)
+	binary.LittleEndian.PutUint16(fmt[2:], 2)
+	binary.LittleEndian.PutUint32(fmt[4:], 44100)
+	binary.LittleEndian.PutUint32(fmt[8:], 176400)
+	binary.LittleEndian.PutUint16(fmt[12:], 4)
+	binary.LittleEndian.PutUint16(fmt[14:], 16)
+	return wavChunk("fmt ", 16, fmt)
+}
+
+func xingFrame(frames uint32) []byte {
+	frame := mp3Frames(1)
+	copy(frame[36:], "Xing\x00\x00\x00\x01")
+	binary.BigEndian.PutUint32(frame[44:], frames)
+	return frame
+}
+
+func TestSniff(t *testing.T) {
+	cbr := mp3Frames(100)
+	tests := []struct {
+		name     string
+		data     []byte
+		want     Header
+		duration time.Duration // allowed error of the duration
+	}{
+		{"mp3", cbr, Header{ContainerMP3, playTime(int64(len(cbr)), 128000), 128000}, 0},
+		{"mp3 after junk", append([]byte("\x00\xff\x00junk"), cbr...), Header{ContainerMP3, playTime(int64(len(cbr)), 128000), 128000}, 0},
+		{"mp3 with ID3 tags", append(append(id3Tag(1000), cbr...), append([]byte("TAG"), make([]byte, 125)...)...),
+			Header{ContainerMP3, playTime(int64(len(cbr)), 128000), 128000}, 0},
+		{"mp3 with Xing", append(xingFrame(1000), mp3Frames(99)...),
+			Header{ContainerMP3, 1000 * 1152 * time.Second / 44100, bitRate(100*417, 1000*1152*time.Second/44100)}, time.Millisecond},
+		{"adts", adtsFrames(10), Header{ContainerADTS, playTime(2000, 68906), 68906}, 0},
+		{"mp4", append(mp4Atom("ftyp", []byte("M4A \x00\x00\x00\x00")), mp4Atom("moov", mvhd(1000, 60000))...),
+			Header{ContainerMP4, time.Minute, 0}, 0},
+		{"wav", wavFile(wavFmt(), wavChunk("LIST", 3, []byte("abc\x00")), wavChunk("data", 352800, make([]byte, 352800))),
+			Header{ContainerWAV, 2 * time.Second, 1411200}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "audio")
+			if err := ioutil.WriteFile(file, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := Sniff(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want.Container == ContainerMP4 {
+				// the bitrate of the whole file
+				tt.want.BitRate = bitRate(int64(len(tt.data)), tt.want.Duration)
+			}
+			diff := got.Duration - tt.want.Duration
+			if diff < 0 {
+				diff = -diff
+			}
+			if got.Container != tt.want.Container || got.BitRate != tt.want.BitRate || diff > tt.duration {
+				t.Errorf("got %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSniffErrors(t *testing.T) {
+	ftyp := mp4Atom("ftyp", []byte("M4A \x00\x00\x00\x00"))
+	truncatedMoov := mp4Atom("moov", mvhd(1000, 60000))
+	truncatedMoov = truncatedMoov[:len(truncatedMoov)-50]
+	tests := []struct {
+		name     string
+		data     []byte
+		notAudio bool
+	}{
+		{name: "empty"},
+		{name: "text", data: []byte("#EXTM3U\nhttp://example.com/stream.mp3\n"), notAudio: true},
+		{name: "lone sync bytes", data: append([]byte{0xff, 0xfb, 0x90, 0x64}, make([]byte, 1000)...), notAudio: true},
+		{name: "only ID3", data: id3Tag(100)},
+		{name: "ID3 without audio", data: append(id3Tag(100), make([]byte, 1000)...), notAudio: true},
+		{name: "mp4 without moov", data: append(ftyp, mp4Atom("mdat", make([]byte, 1000))...)},
+		{name: "mp4 truncated", data: append(ftyp, truncatedMoov...)},
+		{name: "mp4 without mvhd", data: append(ftyp, mp4Atom("moov", mp4Atom("trak"))...)},
+		{name: "wav without data", data: wavFile(wavFmt())},
+		{name: "wav without fmt", data: wavFile(wavChunk("data", 4, make([]byte, 4)))},
+		{name: "wav truncated", data: wavFile(wavFmt(), wavChunk("data", 1000, make([]byte, 10)))},
+		{name: "wav short fmt", data: wavFile(wavChunk("fmt ", 8, make([]byte, 8)), wavChunk("data", 4, make([]byte, 4)))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "audio")
+			if err := ioutil.WriteFile(file, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			header, err := Sniff(file)
+			if err == nil {
+				t.Fatalf("got %+v, want an error", *header)
+			}
+			if (err == ErrNotAudio) != tt.notAudio {
+				t.Errorf("got %v, want ErrNotAudio %v", err, tt.notAudio)
+			}
+		})
+	}
+	if _, err := Sniff(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("a missing file is sniffed")
+	}
+}
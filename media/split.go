@@ -0,0 +1,79 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Silence is a quiet interval of a file
+type Silence struct {
+	Start, End time.Duration
+}
+
+// Middle returns the middle of the interval
+func (s Silence) Middle() time.Duration {
+	return s.Start + (s.End-s.Start)/2
+}
+
+var silenceRe = regexp.MustCompile(`silence_(start|end): (-?\d+(?:\.\d+)?)`)
+
+// DetectSilence returns the quiet intervals of the file in order. It has to
+// decode the whole file.
+func DetectSilence(ctx context.Context, file string, progress Progress) (silences []Silence, err error) {
+	var start time.Duration
+	inSilence := false
+	_, err = run(ctx, []string{
+		FFmpeg, "-hide_banner", "-nostdin", "-i", file,
+		"-map", "0:a:0", "-af", "silencedetect=noise=-35dB:d=0.7", "-f", "null", "-",
+	}, 0, progress, func(line string) {
+		m := silenceRe.FindStringSubmatch(line)
+		if m == nil {
+			return
+		}
+		seconds, err := strconv.ParseFloat(m[2], 64)
+		if err != nil {
+			return
+		}
+		at := time.Duration(seconds * float64(time.Second))
+		if at < 0 {
+			at = 0
+		}
+		if m[1] == "start" {
+			start = at
+			inSilence = true
+		} else if inSilence {
+			silences = append(silences, Silence{Start: start, End: at})
+			inSilence = false
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(silences, func(i, k int) bool {
+		return silences[i].Start < silences[k].Start
+	})
+	return silences, nil
+}
+
+// formatSeconds formats the duration for the ffmpeg's command line
+func formatSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// Cut copies length of the file starting at start into out without
+// re-encoding. The tags are copied, and the ones in metadata replace them.
+// The format of out is chosen by its extension.
+func Cut(ctx context.Context, in, out string, start, length time.Duration, metadata map[string]string, progress Progress) error {
+	args := []string{
+		FFmpeg, "-hide_banner", "-nostdin", "-y",
+		"-ss", formatSeconds(start), "-i", in, "-t", formatSeconds(length),
+		"-map", "0:a", "-map_metadata", "0", "-c", "copy",
+	}
+	args = append(args, metadataArgs(metadata)...)
+	_, err := run(ctx, append(args, out), length, progress, nil)
+	return err
+}
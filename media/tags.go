@@ -0,0 +1,109 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// CanEmbed reports whether the format of the file, chosen by its extension,
+// holds the artwork and the chapters. The .wav and .aac files can't.
+func CanEmbed(file string) bool {
+	ext := strings.ToLower(filepath.Ext(file))
+	return ext != ".wav" && ext != ".aac"
+}
+
+// metadataArgs returns the ffmpeg options setting the tags, in the order of
+// the keys
+func metadataArgs(metadata map[string]string) (args []string) {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, "-metadata", key+"="+metadata[key])
+	}
+	return
+}
+
+// Tag copies the file into out replacing the tags in metadata and, if
+// artwork isn't empty, the artwork with the image, and, if chapters aren't
+// nil, the chapters. The artwork and the chapters are left out if the
+// format of out can't hold them, see CanEmbed. The audio isn't re-encoded.
+// Tags of mp3 files are written as ID3v2.3, the most compatible version,
+// with CHAP and CTOC frames for the chapters; m4a and m4b files get
+// iTunes-style atoms with QuickTime and Nero chapters.
+func Tag(ctx context.Context, in, out string, metadata map[string]string, artwork string, chapters []Chapter, progress Progress) error {
+	var metaFile string
+	if chapters != nil && CanEmbed(out) {
+		var err error
+		metaFile, err = writeTemp(out, "*.ffmetadata", FFMetadata(nil, chapters))
+		if err != nil {
+			return err
+		}
+		defer os.Remove(metaFile)
+	}
+	_, err := run(ctx, tagArgs(in, out, metadata, artwork, metaFile), 0, progress, nil)
+	return err
+}
+
+// tagArgs returns the ffmpeg command of Tag, the chapters are read from the
+// metaFile if it isn't empty. All the inputs go first, ffmpeg applies the
+// options before an -i to that input.
+func tagArgs(in, out string, metadata map[string]string, artwork, metaFile string) []string {
+	embed := CanEmbed(out)
+	if !embed {
+		artwork, metaFile = "", ""
+	}
+	args := []string{FFmpeg, "-hide_banner", "-nostdin", "-y", "-i", in}
+	inputs := 1
+	artworkInput, chaptersInput := -1, -1
+	if artwork != "" {
+		args = append(args, "-i", artwork)
+		artworkInput = inputs
+		inputs++
+	}
+	if metaFile != "" {
+		args = append(args, "-i", metaFile)
+		chaptersInput = inputs
+		inputs++
+	}
+
+	args = append(args, "-map", "0:a")
+	if artworkInput >= 0 {
+		args = append(args, "-map", fmt.Sprintf("%d:0", artworkInput))
+	} else if embed {
+		// keep the artwork the file already has
+		args = append(args, "-map", "0:v?")
+	}
+	if chaptersInput >= 0 {
+		args = append(args, "-map_chapters", fmt.Sprint(chaptersInput))
+	}
+	args = append(args, "-map_metadata", "0", "-c", "copy")
+	if embed {
+		args = append(args, "-disposition:v", "attached_pic")
+	}
+	if strings.EqualFold(filepath.Ext(out), ".mp3") {
+		args = append(args, "-id3v2_version", "3")
+		if artwork != "" {
+			args = append(args, "-metadata:s:v", "title=Album cover", "-metadata:s:v", "comment=Cover (front)")
+		}
+	}
+	args = append(args, metadataArgs(metadata)...)
+	return append(args, out)
+}
+
+// ResizeImage scales the image down to fit into a size by size square and
+// saves it as out, the format is chosen by the extension.
+func ResizeImage(ctx context.Context, in, out string, size int) error {
+	_, err := run(ctx, []string{
+		FFmpeg, "-hide_banner", "-nostdin", "-y", "-i", in,
+		"-vf", fmt.Sprintf("scale=w=%d:h=%d:force_original_aspect_ratio=decrease", size, size),
+		"-frames:v", "1", "-q:v", "2", out,
+	}, 0, nil, nil)
+	return err
+}
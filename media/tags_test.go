@@ -0,0 +1,116 @@
+package media
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTagArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		out      string
+		artwork  string
+		metaFile string
+		want     []string
+	}{
+		{
+			name: "tags only",
+			out:  "out.m4a",
+			want: []string{
+				"-i", "in",
+				"-map", "0:a", "-map", "0:v?",
+				"-map_metadata", "0", "-c", "copy", "-disposition:v", "attached_pic",
+				"-metadata", "title=Ep", "out.m4a",
+			},
+		},
+		{
+			name:    "artwork",
+			out:     "out.mp3",
+			artwork: "cover.jpg",
+			want: []string{
+				"-i", "in", "-i", "cover.jpg",
+				"-map", "0:a", "-map", "1:0",
+				"-map_metadata", "0", "-c", "copy", "-disposition:v", "attached_pic",
+				"-id3v2_version", "3", "-metadata:s:v", "title=Album cover", "-metadata:s:v", "comment=Cover (front)",
+				"-metadata", "title=Ep", "out.mp3",
+			},
+		},
+		{
+			name:     "chapters",
+			out:      "out.mp3",
+			metaFile: "ch.ffmetadata",
+			want: []string{
+				"-i", "in", "-i", "ch.ffmetadata",
+				"-map", "0:a", "-map", "0:v?", "-map_chapters", "1",
+				"-map_metadata", "0", "-c", "copy", "-disposition:v", "attached_pic",
+				"-id3v2_version", "3",
+				"-metadata", "title=Ep", "out.mp3",
+			},
+		},
+		{
+			name:     "artwork and chapters",
+			out:      "out.m4b",
+			artwork:  "cover.png",
+			metaFile: "ch.ffmetadata",
+			want: []string{
+				"-i", "in", "-i", "cover.png", "-i", "ch.ffmetadata",
+				"-map", "0:a", "-map", "1:0", "-map_chapters", "2",
+				"-map_metadata", "0", "-c", "copy", "-disposition:v", "attached_pic",
+				"-metadata", "title=Ep", "out.m4b",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tagArgs("in", tt.out, map[string]string{"title": "Ep"}, tt.artwork, tt.metaFile)
+			want := append([]string{FFmpeg, "-hide_banner", "-nostdin", "-y"}, tt.want...)
+			if !reflect.DeepEqual(args, want) {
+				t.Errorf("got  %q\nwant %q", args, want)
+			}
+			// every -i comes before the first output option
+			lastInput, firstMap := -1, len(args)
+			for i, arg := range args {
+				if arg == "-i" {
+					lastInput = i
+				}
+				if arg == "-map" && i < firstMap {
+					firstMap = i
+				}
+			}
+			if lastInput > firstMap {
+				t.Errorf("input after the output options: %q", args)
+			}
+		})
+	}
+}
+
+func TestTagArgsNoEmbedding(t *testing.T) {
+	for _, out := range []string{"out.wav", "out.AAC"} {
+		args := tagArgs("in", out, map[string]string{"title": "Ep"}, "cover.jpg", "ch.ffmetadata")
+		want := []string{
+			FFmpeg, "-hide_banner", "-nostdin", "-y", "-i", "in",
+			"-map", "0:a", "-map_metadata", "0", "-c", "copy",
+			"-metadata", "title=Ep", out,
+		}
+		if !reflect.DeepEqual(args, want) {
+			t.Errorf("got  %q\nwant %q", args, want)
+		}
+		for i, arg := range args {
+			if arg == "-i" && args[i+1] != "in" {
+				t.Errorf("%s: unexpected input %q", out, args[i+1])
+			}
+		}
+	}
+}
+
+func TestCanEmbed(t *testing.T) {
+	tests := map[string]bool{
+		"a.mp3": true, "a.m4a": true, "a.M4B": true,
+		"a.wav": false, "a.WAV": false, "a.aac": false, "dir.wav/a.mp3": true,
+	}
+	for file, want := range tests {
+		if got := CanEmbed(file); got != want {
+			t.Errorf("CanEmbed(%q) = %v, want %v", file, got, want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package media
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Formats are the supported transcoding targets.
+var Formats = []string{"m4a", "mp3"}
+
+// DefaultTranscodeCommand returns the ffmpeg command converting {in} into
+// {out} in the format, keeping the tags. Ogg and Opus keep their tags on
+// the audio stream, so those are copied to the file as well.
+func DefaultTranscodeCommand(format string) (Command, error) {
+	encoder, err := encoderArgs(format)
+	if err != nil {
+		return nil, err
+	}
+	cmd := Command{
+		FFmpeg, "-hide_banner", "-nostdin", "-y", "-i", "{in}",
+		"-map", "0:a:0", "-map_metadata", "0", "-map_metadata", "0:s:a:0",
+	}
+	cmd = append(cmd, encoder...)
+	return append(cmd, "{out}"), nil
+}
+
+// encoderArgs returns the ffmpeg options encoding the audio in the format
+func encoderArgs(format string) ([]string, error) {
+	switch format {
+	case "m4a":
+		return []string{"-c:a", "aac", "-b:a", "192k", "-movflags", "+faststart", "-f", "ipod"}, nil
+	case "mp3":
+		return []string{"-c:a", "libmp3lame", "-q:a", "2", "-id3v2_version", "3", "-f", "mp3"}, nil
+	}
+	return nil, errors.Errorf("unsupported format %q", format)
+}
+
+// Transcode converts the file in into out with the command, see
+// DefaultTranscodeCommand.
+func Transcode(ctx context.Context, cmd Command, in, out string, progress Progress) error {
+	_, err := run(ctx, cmd.Expand(map[string][]string{
+		"in":  {in},
+		"out": {out},
+	}), 0, progress, nil)
+	return err
+}
+
+// encoderForExt returns the ffmpeg options encoding the audio for a file
+// with the extension
+func encoderForExt(ext string) ([]string, error) {
+	switch strings.ToLower(ext) {
+	case ".mp3":
+		return encoderArgs("mp3")
+	case ".m4a", ".m4b":
+		return encoderArgs("m4a")
+	case ".aac":
+		return []string{"-c:a", "aac", "-b:a", "192k", "-f", "adts"}, nil
+	case ".wav":
+		return []string{"-c:a", "pcm_s16le", "-f", "wav"}, nil
+	}
+	return nil, errors.Errorf("can't encode %s files", ext)
+}
@@ -0,0 +1,155 @@
+package overcast
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// AuthData is everything needed to restore a session: the session cookies
+// and, optionally, the credentials to fall back on when they expire.
+type AuthData struct {
+	Creds   *Creds
+	Cookies BasicCookies
+}
+
+type BasicCookie struct {
+	Name  string
+	Value string
+}
+
+type BasicCookies []*BasicCookie
+
+// HTTPCookies converts the cookies to the net/http representation.
+func (bc BasicCookies) HTTPCookies() []*http.Cookie {
+	res := make([]*http.Cookie, len(bc))
+	for i, cookie := range bc {
+		res[i] = &http.Cookie{
+			Name:  cookie.Name,
+			Value: cookie.Value,
+		}
+	}
+	return res
+}
+
+type Creds struct {
+	Email    string
+	Password string
+}
+
+// ErrStaleCookies is returned by Client.Auth when the saved cookies have
+// expired, but the password worked. The session is established, AuthData
+// contains the fresh cookies and should be saved again.
+var ErrStaleCookies = errors.New("Cookies are stale, but password had worked")
+
+// Login logs in with email and password.
+func (c *Client) Login(ctx context.Context, creds *Creds) (uploads *UploadsPage, err error) {
+	if creds == nil || (creds.Email == "" && creds.Password == "") {
+		return nil, errors.New("no credentials")
+	}
+
+	postdata := url.Values{
+		"then":     {"uploads"},
+		"email":    {creds.Email},
+		"password": {creds.Password},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.url("login"), strings.NewReader(postdata.Encode()))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		err = errors.Errorf("unexpected HTTP response on login: %d", resp.StatusCode)
+		return
+	}
+
+	if strings.HasSuffix(resp.Request.URL.Path, "login") {
+		err = errors.New("failed to login: wrong password")
+		return
+	}
+
+	if !strings.HasSuffix(resp.Request.URL.Path, "uploads") {
+		err = errors.Errorf("failed to login: request in unknown place %s", resp.Request.URL.String())
+		return
+	}
+
+	return parseUploadsResponse(resp)
+}
+
+// LoginWithCookies restores a session from saved cookies.
+func (c *Client) LoginWithCookies(ctx context.Context, bc BasicCookies) (uploads *UploadsPage, err error) {
+	if len(bc) == 0 {
+		return nil, errors.New("no cookies found")
+	}
+
+	c.HTTPClient.Jar.SetCookies(c.BaseURL, bc.HTTPCookies())
+
+	uploads, err = c.UploadsPage(ctx)
+	if err == ErrNotLoggedIn {
+		err = errors.New("cookies have expired")
+	}
+	return
+}
+
+// Auth establishes a session using the saved cookies, falling back to the
+// credentials. On success ad.Cookies are updated with the current session.
+func (c *Client) Auth(ctx context.Context, ad *AuthData) (uploads *UploadsPage, err error) {
+	if ad == nil {
+		return nil, errors.New("no auth data found")
+	}
+
+	defer func() {
+		// on successful authorization
+		if err == nil || err == ErrStaleCookies {
+			ad.Cookies = c.Cookies()
+		}
+	}()
+
+	if len(ad.Cookies) != 0 {
+		uploads, err = c.LoginWithCookies(ctx, ad.Cookies)
+		if err == nil {
+			return
+		}
+	}
+	if ad.Creds != nil {
+		uploads, err = c.Login(ctx, ad.Creds)
+		if err == nil {
+			if len(ad.Cookies) != 0 {
+				err = ErrStaleCookies
+			}
+			return
+		}
+	}
+	return
+}
+
+// Cookies returns the cookies of the current session.
+func (c *Client) Cookies() BasicCookies {
+	cookies := c.HTTPClient.Jar.Cookies(c.BaseURL)
+	res := make(BasicCookies, len(cookies))
+	for i, cookie := range cookies {
+		res[i] = &BasicCookie{
+			Name:  cookie.Name,
+			Value: cookie.Value,
+		}
+	}
+	return res
+}
+
+func ParseAuthData(data []byte) (res *AuthData, err error) {
+	res = &AuthData{}
+	err = json.Unmarshal(data, &res)
+	return
+}
@@ -0,0 +1,75 @@
+// Package overcast is an unofficial client for the Overcast® Premium upload
+// feature.
+//
+// Technically it's just a wrapper around the upload form at
+// https://overcast.fm/uploads: Client handles the login and parses the uploads
+// page, Uploader sends the files to the presigned S3 form and tells Overcast
+// about them.
+package overcast
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultBaseURL is the address of the real Overcast website.
+const DefaultBaseURL = "https://overcast.fm/"
+
+// Client talks to the Overcast website. The session is kept in the cookie jar
+// of the underlying http.Client.
+type Client struct {
+	HTTPClient *http.Client
+	BaseURL    *url.URL
+}
+
+// NewClient returns a Client for the Overcast instance at baseURL.
+//
+//	`httpClient` client used for all requests, must have a cookie jar.
+//	             If nil, a new client with an empty jar is used.
+//
+//	`baseURL`    address of the Overcast website, DefaultBaseURL if empty
+func NewClient(httpClient *http.Client, baseURL string) (*Client, error) {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid base URL")
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, errors.Errorf("invalid base URL %q: scheme and host are required", baseURL)
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+
+	if httpClient == nil {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			return nil, err
+		}
+		httpClient = &http.Client{Jar: jar}
+	}
+	if httpClient.Jar == nil {
+		return nil, errors.New("http client must have a cookie jar")
+	}
+
+	return &Client{
+		HTTPClient: httpClient,
+		BaseURL:    u,
+	}, nil
+}
+
+// url resolves path against the base URL.
+func (c *Client) url(path string) string {
+	return c.BaseURL.ResolveReference(&url.URL{Path: path}).String()
+}
+
+// origin is the value of the Origin header the website would send.
+func (c *Client) origin() string {
+	return c.BaseURL.Scheme + "://" + c.BaseURL.Host
+}
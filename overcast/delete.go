@@ -0,0 +1,47 @@
+package overcast
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNotDeletable is returned for uploads without a delete form.
+var ErrNotDeletable = errors.New("no delete form found for the upload")
+
+// Delete removes the uploaded file from the account, the same way the
+// delete button on the uploads page does.
+func (c *Client) Delete(ctx context.Context, upload *Upload) (err error) {
+	if upload.DeleteURL == "" {
+		return ErrNotDeletable
+	}
+
+	postdata := url.Values{}
+	for key, value := range upload.DeleteData {
+		postdata.Set(key, value)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", upload.DeleteURL, strings.NewReader(postdata.Encode()))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Origin", c.origin())
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if strings.HasSuffix(resp.Request.URL.Path, "login") {
+		return ErrNotLoggedIn
+	}
+	if resp.StatusCode != 200 {
+		return errors.Errorf("Unexpected status code from overcast: %d", resp.StatusCode)
+	}
+	return
+}
@@ -0,0 +1,337 @@
+package overcast_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Andrew-Morozko/cloudy-uploader/overcast"
+	"github.com/Andrew-Morozko/cloudy-uploader/overcasttest"
+	"github.com/pkg/errors"
+)
+
+// login logs in to the fake server and returns the uploader of its form
+func login(t *testing.T, srv *overcasttest.Server) *overcast.Uploader {
+	t.Helper()
+	oc, err := overcast.NewClient(nil, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := oc.Login(context.Background(), &overcast.Creds{Email: srv.Email, Password: srv.Password})
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	params, err := page.Params()
+	if err != nil {
+		t.Fatalf("params: %v", err)
+	}
+	uploader := oc.NewUploader(params)
+	uploader.Retry = overcast.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	return uploader
+}
+
+// writeFile creates a file of size bytes in a temporary folder
+func writeFile(t *testing.T, name string, size int) (path string, data []byte) {
+	t.Helper()
+	data = bytes.Repeat([]byte("overcast"), size/8+1)[:size]
+	path = filepath.Join(t.TempDir(), name)
+	err := ioutil.WriteFile(path, data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, data
+}
+
+func TestLoginWrongPassword(t *testing.T) {
+	srv := overcasttest.NewServer()
+	defer srv.Close()
+	oc, err := overcast.NewClient(nil, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = oc.Login(context.Background(), &overcast.Creds{Email: srv.Email, Password: "wrong"})
+	if err == nil {
+		t.Fatal("logged in with a wrong password")
+	}
+}
+
+func TestUploadAndSubmit(t *testing.T) {
+	srv := overcasttest.NewServer()
+	defer srv.Close()
+	srv.FailUploads = 1
+	uploader := login(t, srv)
+
+	params := uploader.Params
+	if params.DataKeyPrefix != srv.KeyPrefix {
+		t.Errorf("key prefix %q, want %q", params.DataKeyPrefix, srv.KeyPrefix)
+	}
+	if params.MaxFileSize != srv.MaxBytes || params.SpaceAvailable != srv.FreeBytes || params.MaxFileCount != srv.MaxFiles {
+		t.Errorf("limits %d/%d/%d, want %d/%d/%d", params.MaxFileSize, params.SpaceAvailable, params.MaxFileCount,
+			srv.MaxBytes, srv.FreeBytes, srv.MaxFiles)
+	}
+	if params.Policy == nil {
+		t.Fatal("the policy isn't decoded")
+	}
+
+	path, data := writeFile(t, "episode.mp3", 20000)
+	var retries int
+	err := uploader.Upload(context.Background(), &overcast.File{
+		Path:   path,
+		Name:   "episode.mp3",
+		Size:   int64(len(data)),
+		Verify: true,
+		OnRetry: func(retry int, delay time.Duration, err error) {
+			retries++
+		},
+	})
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if retries != 1 {
+		t.Errorf("%d retries, want 1", retries)
+	}
+	key := uploader.Key("episode.mp3")
+	stored, found := srv.Object(key)
+	if !found || !bytes.Equal(stored, data) {
+		t.Fatalf("S3 has %d bytes under %q (found %v), want %d", len(stored), key, found, len(data))
+	}
+	if len(srv.Submitted()) != 0 {
+		t.Fatalf("submitted before Submit: %v", srv.Submitted())
+	}
+
+	err = uploader.Submit(context.Background(), key)
+	if err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	if got, want := srv.Submitted(), []string{key}; !reflect.DeepEqual(got, want) {
+		t.Errorf("submitted %v, want %v", got, want)
+	}
+
+	page, err := uploader.Client.UploadsPage(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploads := page.Uploads()
+	if len(uploads) != 1 || uploads[0].Name != "episode.mp3" || !uploads[0].SizeMatches(int64(len(data))) {
+		t.Errorf("uploads page lists %+v", uploads)
+	}
+}
+
+func TestUploadRejectedByPolicy(t *testing.T) {
+	srv := overcasttest.NewServer()
+	defer srv.Close()
+	srv.MaxBytes = 100
+	uploader := login(t, srv)
+
+	path, data := writeFile(t, "big.mp3", 1000)
+	err := uploader.Upload(context.Background(), &overcast.File{Path: path, Name: "big.mp3", Size: int64(len(data))})
+	if err == nil {
+		t.Fatal("the file larger than the policy allows was uploaded")
+	}
+	if _, found := srv.Object(uploader.Key("big.mp3")); found {
+		t.Error("the rejected file is stored")
+	}
+}
+
+func TestUploadRefreshesExpiredForm(t *testing.T) {
+	tests := []struct {
+		name string
+		// unknownExpiry hides the expiration from the uploader, so it only
+		// learns about it from S3
+		unknownExpiry bool
+	}{
+		{"expiring form", false},
+		{"expired by S3", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := overcasttest.NewServer()
+			defer srv.Close()
+			srv.PolicyTTL = -time.Minute
+			uploader := login(t, srv)
+			if tt.unknownExpiry {
+				uploader.Params.Policy = nil
+			}
+			oldPolicy := uploader.Params.PostField("policy")
+			srv.Update(func(s *overcasttest.Server) {
+				s.PolicyTTL = time.Hour
+			})
+
+			path, data := writeFile(t, "late.mp3", 5000)
+			var refreshes int
+			err := uploader.Upload(context.Background(), &overcast.File{
+				Path:      path,
+				Name:      "late.mp3",
+				Size:      int64(len(data)),
+				OnRefresh: func() { refreshes++ },
+			})
+			if err != nil {
+				t.Fatalf("upload: %v", err)
+			}
+			if refreshes != 1 {
+				t.Errorf("%d refreshes, want 1", refreshes)
+			}
+			if uploader.Params.PostField("policy") == oldPolicy {
+				t.Error("the form wasn't replaced")
+			}
+			if _, found := srv.Object(uploader.Key("late.mp3")); !found {
+				t.Error("the file isn't stored")
+			}
+		})
+	}
+}
+
+func TestUploadFormAlwaysExpired(t *testing.T) {
+	srv := overcasttest.NewServer()
+	defer srv.Close()
+	srv.PolicyTTL = -time.Minute
+	uploader := login(t, srv)
+
+	path, data := writeFile(t, "late.mp3", 5000)
+	var refreshes int
+	err := uploader.Upload(context.Background(), &overcast.File{
+		Path:      path,
+		Name:      "late.mp3",
+		Size:      int64(len(data)),
+		OnRefresh: func() { refreshes++ },
+	})
+	var s3err *overcast.S3Error
+	if !errors.As(err, &s3err) || !s3err.Expired() {
+		t.Fatalf("got %v, want an expired policy error from S3", err)
+	}
+	if refreshes != 1 {
+		t.Errorf("%d refreshes, want 1", refreshes)
+	}
+}
+
+func TestUploadContentType(t *testing.T) {
+	srv := overcasttest.NewServer()
+	defer srv.Close()
+	srv.ContentTypePrefix = "audio/"
+	uploader := login(t, srv)
+
+	// the matching type is sent with the file
+	path, data := writeFile(t, "episode.mp3", 3000)
+	err := uploader.Upload(context.Background(), &overcast.File{Path: path, Name: "episode.mp3", Size: int64(len(data))})
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if got := srv.Fields(uploader.Key("episode.mp3"))["Content-Type"]; got != "audio/mpeg" {
+		t.Errorf("Content-Type %q, want audio/mpeg", got)
+	}
+
+	// the mismatched one is rejected before the upload
+	path, data = writeFile(t, "notes.bin", 3000)
+	if err = uploader.Check("notes.bin", int64(len(data))); err == nil {
+		t.Error("the check allows application/octet-stream")
+	}
+	err = uploader.Upload(context.Background(), &overcast.File{Path: path, Name: "notes.bin", Size: int64(len(data))})
+	var s3err *overcast.S3Error
+	if err == nil || errors.As(err, &s3err) {
+		t.Fatalf("got %v, want the policy error before the upload", err)
+	}
+	if _, found := srv.Object(uploader.Key("notes.bin")); found {
+		t.Error("the rejected file is stored")
+	}
+
+	// S3 rejects it too if the policy is unknown
+	uploader.Params.Policy = nil
+	err = uploader.Upload(context.Background(), &overcast.File{Path: path, Name: "notes.bin", Size: int64(len(data))})
+	if !errors.As(err, &s3err) || s3err.Code != "AccessDenied" {
+		t.Fatalf("got %v, want AccessDenied from S3", err)
+	}
+	if _, found := srv.Object(uploader.Key("notes.bin")); found {
+		t.Error("the rejected file is stored")
+	}
+}
+
+func TestUploadRefreshChangesKeyPrefix(t *testing.T) {
+	srv := overcasttest.NewServer()
+	defer srv.Close()
+	srv.PolicyTTL = -time.Minute
+	uploader := login(t, srv)
+	srv.Update(func(s *overcasttest.Server) {
+		s.PolicyTTL = time.Hour
+		s.KeyPrefix = "uploads/2/"
+		s.MaxBytes = 10000
+		s.FreeBytes = 50000
+		s.MaxFiles = 3
+	})
+
+	path, data := writeFile(t, "moved.mp3", 5000)
+	f := &overcast.File{Path: path, Name: "moved.mp3", Size: int64(len(data))}
+	if err := uploader.Upload(context.Background(), f); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if want := "uploads/2/moved.mp3"; f.Key != want || uploader.Key("moved.mp3") != want {
+		t.Errorf("key %q, uploader key %q, want %q", f.Key, uploader.Key("moved.mp3"), want)
+	}
+	if _, found := srv.Object(f.Key); !found {
+		t.Fatal("the file isn't stored under the new prefix")
+	}
+	params := uploader.Params
+	if params.MaxFileSize != 10000 || params.SpaceAvailable != 50000 || params.MaxFileCount != 3 {
+		t.Errorf("limits %d/%d/%d, want the ones of the new form", params.MaxFileSize, params.SpaceAvailable, params.MaxFileCount)
+	}
+	if err := uploader.Check("moved.mp3", 20000); err == nil {
+		t.Error("the check uses the old size limit")
+	}
+	if err := uploader.Submit(context.Background(), f.Key); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+}
+
+func TestUploadVerifyContentMD5(t *testing.T) {
+	srv := overcasttest.NewServer()
+	defer srv.Close()
+	srv.ContentMD5 = true
+	uploader := login(t, srv)
+
+	path, data := writeFile(t, "checked.mp3", 7000)
+	for _, verify := range []bool{false, true} {
+		err := uploader.Upload(context.Background(), &overcast.File{Path: path, Name: "checked.mp3", Size: int64(len(data)), Verify: verify})
+		if err != nil {
+			t.Fatalf("upload: %v", err)
+		}
+		sum := md5.Sum(data)
+		want := ""
+		if verify {
+			want = base64.StdEncoding.EncodeToString(sum[:])
+		}
+		if got := srv.Fields(uploader.Key("checked.mp3"))["Content-MD5"]; got != want {
+			t.Errorf("verify %v: Content-MD5 %q, want %q", verify, got, want)
+		}
+	}
+}
+
+func TestUploadCorrupted(t *testing.T) {
+	srv := overcasttest.NewServer()
+	defer srv.Close()
+	srv.CorruptUploads = 1
+	uploader := login(t, srv)
+
+	path, data := writeFile(t, "damaged.mp3", 7000)
+	err := uploader.Upload(context.Background(), &overcast.File{Path: path, Name: "damaged.mp3", Size: int64(len(data)), Verify: true})
+	var integrityErr *overcast.IntegrityError
+	if !errors.As(err, &integrityErr) {
+		t.Fatalf("got %v, want an IntegrityError", err)
+	}
+	if stored, _ := srv.Object(uploader.Key("damaged.mp3")); bytes.Equal(stored, data) {
+		t.Fatal("the server didn't damage the upload")
+	}
+
+	// the next upload isn't damaged
+	err = uploader.Upload(context.Background(), &overcast.File{Path: path, Name: "damaged.mp3", Size: int64(len(data)), Verify: true})
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if stored, _ := srv.Object(uploader.Key("damaged.mp3")); !bytes.Equal(stored, data) {
+		t.Error("the upload is damaged")
+	}
+}
@@ -0,0 +1,99 @@
+package overcast
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// checksums hashes the data written to it with MD5 and SHA-256
+type checksums struct {
+	md5    hash.Hash
+	sha256 hash.Hash
+	// size of the hashed data
+	size int64
+}
+
+func newChecksums() *checksums {
+	return &checksums{md5: md5.New(), sha256: sha256.New()}
+}
+
+func (c *checksums) Write(p []byte) (int, error) {
+	c.md5.Write(p)
+	c.sha256.Write(p)
+	c.size += int64(len(p))
+	return len(p), nil
+}
+
+func (c *checksums) MD5() string {
+	return hex.EncodeToString(c.md5.Sum(nil))
+}
+
+func (c *checksums) SHA256() string {
+	return hex.EncodeToString(c.sha256.Sum(nil))
+}
+
+// checksumFields are the form fields S3 checks the file against, with
+// their base64 values. They're sent only if the policy allows them.
+var checksumFields = []struct {
+	name  string
+	value func(c *checksums) string
+}{
+	{"Content-MD5", func(c *checksums) string {
+		return base64.StdEncoding.EncodeToString(c.md5.Sum(nil))
+	}},
+	{"x-amz-checksum-sha256", func(c *checksums) string {
+		return base64.StdEncoding.EncodeToString(c.sha256.Sum(nil))
+	}},
+}
+
+// hashFile returns the checksums of the first size bytes of the file
+func hashFile(path string, size int64) (*checksums, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	sums := newChecksums()
+	_, err = io.Copy(sums, io.LimitReader(file, size))
+	if err != nil {
+		return nil, err
+	}
+	return sums, nil
+}
+
+// IntegrityError is returned if S3 has stored different data than was sent.
+type IntegrityError struct {
+	Reason string
+}
+
+func (e *IntegrityError) Error() string {
+	return "the upload is damaged: " + e.Reason
+}
+
+// checkETag compares the ETag of the stored object with the MD5 of the sent
+// data. The ETags of KMS encrypted or multipart objects aren't MD5 and are
+// skipped.
+func checkETag(header http.Header, sums *checksums) error {
+	if header.Get("x-amz-server-side-encryption") == "aws:kms" {
+		return nil
+	}
+	etag := strings.ToLower(strings.Trim(header.Get("ETag"), `"`))
+	if len(etag) != 2*md5.Size {
+		return nil
+	}
+	if _, err := hex.DecodeString(etag); err != nil {
+		return nil
+	}
+	if etag != sums.MD5() {
+		return &IntegrityError{fmt.Sprintf("S3 reports MD5 %s, the sent data has %s", etag, sums.MD5())}
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package overcast
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/pkg/errors"
+)
+
+// ErrNotLoggedIn is returned when Overcast redirects away from the uploads
+// page, i.e. the session is missing or expired.
+var ErrNotLoggedIn = errors.New("not logged in")
+
+// UploadsPage is the parsed /uploads page of a logged in account.
+type UploadsPage struct {
+	doc *goquery.Document
+	// url of the page, if known
+	url *url.URL
+}
+
+// resolve makes the link on the page absolute
+func (p *UploadsPage) resolve(href string) string {
+	if p.url == nil {
+		return href
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return href
+	}
+	return p.url.ResolveReference(ref).String()
+}
+
+// Params are the limits and upload form extracted from the /uploads page.
+//
+// Limits that couldn't be parsed are set to -1.
+type Params struct {
+	SpaceAvailable int64
+	MaxFileCount   int
+	MaxFileSize    int64
+	PostData       map[string]string
+	UploadURL      string
+	DataKeyPrefix  string
+	// AllowedExts are the lowercase extensions of the accepted files,
+	// without the dot. Nil if the page doesn't tell.
+	AllowedExts []string
+	// Policy is the decoded S3 POST policy from PostData, nil if the form
+	// has none or it can't be decoded
+	Policy *Policy
+}
+
+// PostField returns the value of the form field, empty if there's none.
+// The names are case insensitive like in S3.
+func (p *Params) PostField(name string) string {
+	for field, value := range p.PostData {
+		if strings.EqualFold(field, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+// ParseUploadsPage parses the HTML of the /uploads page.
+func ParseUploadsPage(body io.Reader) (*UploadsPage, error) {
+	doc, err := goquery.NewDocumentFromReader(body)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error while parsing /uploads page")
+	}
+	return &UploadsPage{doc: doc}, nil
+}
+
+// UploadsPage fetches the /uploads page using the current session.
+func (c *Client) UploadsPage(ctx context.Context) (*UploadsPage, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.url("uploads"), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to load uploads page")
+	}
+	defer resp.Body.Close()
+
+	if !strings.HasSuffix(resp.Request.URL.Path, "uploads") {
+		return nil, ErrNotLoggedIn
+	}
+	if resp.StatusCode != 200 {
+		return nil, errors.Errorf("unexpected HTTP response on uploads page: %d", resp.StatusCode)
+	}
+
+	return parseUploadsResponse(resp)
+}
+
+func parseUploadsResponse(resp *http.Response) (*UploadsPage, error) {
+	page, err := ParseUploadsPage(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	page.url = resp.Request.URL
+	return page, nil
+}
+
+// parseInfo extracts limitations from the /uploads page
+func parseInfo(input *goquery.Selection) (avalible int64, maxFiles int, maxFile int64) {
+	var err error
+	avalibleStr, found := input.Attr("data-free-bytes")
+	if found {
+		avalible, err = strconv.ParseInt(avalibleStr, 10, 64)
+	}
+	if err != nil || !found {
+		avalible = -1
+	}
+
+	maxFileStr, found := input.Attr("data-max-bytes")
+	if found {
+		maxFile, err = strconv.ParseInt(maxFileStr, 10, 64)
+	}
+	if err != nil || !found {
+		maxFile = -1
+	}
+
+	maxFiles = -1
+
+	info := input.NextFiltered("div.caption2").Text()
+
+	reMaxFiles := regexp.MustCompile(`up\s+to\s+(\d+)`)
+
+	maxFilesStrs := reMaxFiles.FindStringSubmatch(info)
+
+	if len(maxFilesStrs) == 2 {
+		maxFiles, err = strconv.Atoi(maxFilesStrs[1])
+		if err != nil {
+			maxFiles = -1
+		}
+	}
+
+	return
+}
+
+// mimeExts are the extensions of the audio types whose names don't tell
+var mimeExts = map[string][]string{
+	"audio/mpeg":     {"mp3"},
+	"audio/mp4":      {"m4a", "m4b"},
+	"audio/aacp":     {"aac"},
+	"audio/wave":     {"wav"},
+	"audio/vnd.wave": {"wav"},
+}
+
+// parseAccept returns the extensions of the file types in the accept
+// attribute of the file input, nil if any audio file is accepted or there
+// are no types.
+func parseAccept(accept string) (exts []string) {
+	seen := make(map[string]bool)
+	add := func(ext string) {
+		if ext != "" && !seen[ext] {
+			seen[ext] = true
+			exts = append(exts, ext)
+		}
+	}
+	for _, item := range strings.Split(accept, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if i := strings.IndexByte(item, ';'); i >= 0 {
+			// parameters of the type
+			item = strings.TrimSpace(item[:i])
+		}
+		switch {
+		case strings.HasPrefix(item, "."):
+			add(item[1:])
+		case strings.HasSuffix(item, "/*"):
+			return nil
+		case strings.HasPrefix(item, "audio/"):
+			if known, found := mimeExts[item]; found {
+				for _, ext := range known {
+					add(ext)
+				}
+				continue
+			}
+			add(strings.TrimPrefix(strings.TrimPrefix(item, "audio/"), "x-"))
+		}
+	}
+	return exts
+}
+
+// Params extracts the upload form and the account limits.
+func (p *UploadsPage) Params() (params *Params, err error) {
+	var overcastParams Params
+
+	form := p.doc.Find("form#upload_form")
+
+	prefix, found := form.Attr("data-key-prefix")
+	if !found {
+		err = errors.New("Failed to parse upload form: no data-key-prefix found")
+		return
+	}
+	overcastParams.DataKeyPrefix = prefix
+	overcastParams.PostData = make(map[string]string)
+
+	form.Find(`input[type="hidden"]`).Each(func(i int, s *goquery.Selection) {
+		name, nameFound := s.Attr("name")
+		val, valueFound := s.Attr("value")
+		if nameFound && valueFound {
+			overcastParams.PostData[name] = val
+		}
+	})
+
+	uploadURL, uploadURLFound := form.Attr("action")
+
+	if form.Length() != 1 || len(overcastParams.PostData) == 0 || !uploadURLFound {
+		err = errors.New("Failed to find the upload form")
+		return
+	}
+
+	overcastParams.UploadURL = uploadURL
+	if encoded := overcastParams.PostField("policy"); encoded != "" {
+		overcastParams.Policy, _ = ParsePolicy(encoded)
+	}
+
+	input := p.doc.Find("input#upload_file")
+
+	overcastParams.SpaceAvailable, overcastParams.MaxFileCount, overcastParams.MaxFileSize = parseInfo(input)
+	if accept, found := input.Attr("accept"); found {
+		overcastParams.AllowedExts = parseAccept(accept)
+	}
+
+	return &overcastParams, nil
+}
@@ -0,0 +1,64 @@
+package overcast
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseAccept(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   []string
+	}{
+		{"audio/mpeg,audio/mp4,audio/x-m4a,audio/aac,audio/wav,.m4b", []string{"mp3", "m4a", "m4b", "aac", "wav"}},
+		{" .MP3 , .Mp3 ", []string{"mp3"}},
+		{"audio/mpeg; codecs=mp3", []string{"mp3"}},
+		{"audio/wave,audio/vnd.wave,audio/x-wav", []string{"wav"}},
+		{"audio/ogg,audio/x-flac", []string{"ogg", "flac"}},
+		{"audio/*", nil},
+		{".mp3,audio/*", nil},
+		{"video/mp4,image/png,text/plain", nil},
+		{"", nil},
+		{",,.,", nil},
+	}
+	for _, tt := range tests {
+		if got := parseAccept(tt.accept); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseAccept(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+const formHTML = `<form id="upload_form" action="https://bucket.s3.amazonaws.com/" data-key-prefix="uploads/1/">
+<input type="hidden" name="key" value="uploads/1/${filename}">
+<input type="hidden" name="Policy" value="e30=">
+<input type="file" id="upload_file" name="file" %s data-free-bytes="2000000000" data-max-bytes="500000000">
+<div class="caption2">You can upload up to 50 more files.</div>
+</form>`
+
+func TestParamsAllowedExts(t *testing.T) {
+	tests := []struct {
+		attr string
+		want []string
+	}{
+		{`accept="audio/mpeg,.m4b"`, []string{"mp3", "m4b"}},
+		{`accept="audio/*"`, nil},
+		{``, nil},
+	}
+	for _, tt := range tests {
+		page, err := ParseUploadsPage(strings.NewReader(strings.Replace(formHTML, "%s", tt.attr, 1)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		params, err := page.Params()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(params.AllowedExts, tt.want) {
+			t.Errorf("%s: allowed %q, want %q", tt.attr, params.AllowedExts, tt.want)
+		}
+		if params.PostField("policy") != "e30=" || params.PostField("KEY") != "uploads/1/${filename}" || params.PostField("acl") != "" {
+			t.Errorf("post fields %v", params.PostData)
+		}
+	}
+}
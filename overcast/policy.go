@@ -0,0 +1,214 @@
+package overcast
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrPolicyExpired is returned for the uploads made with an expired form
+var ErrPolicyExpired = errors.New("the upload form has expired")
+
+// Policy is the S3 POST policy of the upload form. It's signed, so S3
+// rejects the uploads that don't satisfy it with 403 Forbidden.
+type Policy struct {
+	// Expiration is when the form stops working, zero if it doesn't
+	Expiration time.Time
+	// MinSize and MaxSize are the content-length-range of the file,
+	// MaxSize is -1 if there's no range
+	MinSize int64
+	MaxSize int64
+	// Key are the conditions on the S3 key
+	Key []PolicyCondition
+	// ContentType are the conditions on the Content-Type field
+	ContentType []PolicyCondition
+
+	// fields are the conditions of all the fields, by lowercase name
+	fields map[string][]PolicyCondition
+}
+
+// PolicyCondition requires a form field to be equal to Value, or to start
+// with it if Prefix is set.
+type PolicyCondition struct {
+	Value  string
+	Prefix bool
+}
+
+// Match reports whether the field value satisfies the condition
+func (c PolicyCondition) Match(value string) bool {
+	if c.Prefix {
+		return strings.HasPrefix(value, c.Value)
+	}
+	return value == c.Value
+}
+
+func (c PolicyCondition) String() string {
+	if c.Prefix {
+		return fmt.Sprintf("start with %q", c.Value)
+	}
+	return fmt.Sprintf("be %q", c.Value)
+}
+
+// ParsePolicy decodes the base64 encoded policy field of the form.
+// The conditions on the fields other than the key and the content type are
+// ignored, they are satisfied by the form itself.
+func ParsePolicy(encoded string) (*Policy, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid policy encoding")
+	}
+	var raw struct {
+		Expiration string            `json:"expiration"`
+		Conditions []json.RawMessage `json:"conditions"`
+	}
+	err = json.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid policy")
+	}
+
+	policy := &Policy{MaxSize: -1, fields: make(map[string][]PolicyCondition)}
+	if raw.Expiration != "" {
+		policy.Expiration, err = time.Parse(time.RFC3339, raw.Expiration)
+		if err != nil {
+			return nil, errors.Errorf("invalid policy expiration %q", raw.Expiration)
+		}
+	}
+	for _, rawCond := range raw.Conditions {
+		err = policy.addCondition(rawCond)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return policy, nil
+}
+
+// addCondition adds a condition in one of the forms
+// {"field": "value"}, ["eq", "$field", "value"],
+// ["starts-with", "$field", "prefix"] or ["content-length-range", min, max]
+func (p *Policy) addCondition(rawCond json.RawMessage) error {
+	var exact map[string]string
+	if json.Unmarshal(rawCond, &exact) == nil {
+		for field, value := range exact {
+			p.add(field, PolicyCondition{Value: value})
+		}
+		return nil
+	}
+
+	var list []interface{}
+	if json.Unmarshal(rawCond, &list) != nil || len(list) != 3 {
+		return errors.Errorf("invalid policy condition %s", rawCond)
+	}
+	op, _ := list[0].(string)
+	switch strings.ToLower(op) {
+	case "content-length-range":
+		min, ok1 := policyNumber(list[1])
+		max, ok2 := policyNumber(list[2])
+		if !ok1 || !ok2 {
+			return errors.Errorf("invalid policy condition %s", rawCond)
+		}
+		p.MinSize, p.MaxSize = min, max
+	case "eq", "starts-with":
+		field, ok1 := list[1].(string)
+		value, ok2 := list[2].(string)
+		if !ok1 || !ok2 || !strings.HasPrefix(field, "$") {
+			return errors.Errorf("invalid policy condition %s", rawCond)
+		}
+		p.add(field[1:], PolicyCondition{Value: value, Prefix: op != "eq"})
+	default:
+		return errors.Errorf("unknown policy condition %s", rawCond)
+	}
+	return nil
+}
+
+// add adds the condition on the field, the field names are case insensitive
+func (p *Policy) add(field string, cond PolicyCondition) {
+	field = strings.ToLower(field)
+	p.fields[field] = append(p.fields[field], cond)
+	switch field {
+	case "key":
+		p.Key = append(p.Key, cond)
+	case "content-type":
+		p.ContentType = append(p.ContentType, cond)
+	}
+}
+
+// Allows reports whether the field may be sent with the value. S3 rejects
+// the fields the policy doesn't mention.
+func (p *Policy) Allows(field, value string) bool {
+	conds := p.fields[strings.ToLower(field)]
+	for _, cond := range conds {
+		if !cond.Match(value) {
+			return false
+		}
+	}
+	return len(conds) != 0
+}
+
+// policyNumber reads the number of a condition, either a JSON number or a
+// string
+func policyNumber(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return int64(v), true
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// ExpiresBefore reports whether the form stops working before t
+func (p *Policy) ExpiresBefore(t time.Time) bool {
+	return !p.Expiration.IsZero() && p.Expiration.Before(t)
+}
+
+// Check returns the reason S3 would reject the file of size bytes (-1 if
+// unknown) uploaded under key, nil if the policy allows it. The expiration
+// isn't checked, see ExpiresBefore.
+func (p *Policy) Check(key, contentType string, size int64) error {
+	for _, cond := range p.Key {
+		if !cond.Match(key) {
+			return errors.Errorf("the key %q must %s", key, cond)
+		}
+	}
+	for _, cond := range p.ContentType {
+		if !cond.Match(contentType) {
+			return errors.Errorf("the content type %q must %s", contentType, cond)
+		}
+	}
+	if size >= 0 && size < p.MinSize {
+		return errors.Errorf("the file is %d bytes, the upload form requires at least %d", size, p.MinSize)
+	}
+	if size >= 0 && p.MaxSize >= 0 && size > p.MaxSize {
+		return errors.Errorf("the file is %d bytes, the upload form allows at most %d", size, p.MaxSize)
+	}
+	return nil
+}
+
+// audioTypes are the content types of the files Overcast accepts
+var audioTypes = map[string]string{
+	".mp3": "audio/mpeg",
+	".m4a": "audio/mp4",
+	".m4b": "audio/mp4",
+	".aac": "audio/aac",
+	".wav": "audio/wav",
+}
+
+// contentTypeOf guesses the content type of the file by its extension
+func contentTypeOf(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if contentType, found := audioTypes[ext]; found {
+		return contentType
+	}
+	if contentType := mime.TypeByExtension(ext); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
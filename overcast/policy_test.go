@@ -0,0 +1,170 @@
+package overcast
+
+import (
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func encodePolicy(json string) string {
+	return base64.StdEncoding.EncodeToString([]byte(json))
+}
+
+func TestParsePolicy(t *testing.T) {
+	policy, err := ParsePolicy(encodePolicy(`{
+		"expiration": "2021-06-03T12:00:00.000Z",
+		"conditions": [
+			{"bucket": "overcast-uploads"},
+			["starts-with", "$key", "uploads/1/"],
+			{"acl": "private"},
+			["eq", "$Content-Type", "audio/mpeg"],
+			["starts-with", "$Content-MD5", ""],
+			["content-length-range", 1, "500000000"]
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2021, 6, 3, 12, 0, 0, 0, time.UTC); !policy.Expiration.Equal(want) {
+		t.Errorf("expiration %v, want %v", policy.Expiration, want)
+	}
+	if policy.MinSize != 1 || policy.MaxSize != 500000000 {
+		t.Errorf("size range %d-%d", policy.MinSize, policy.MaxSize)
+	}
+	if want := []PolicyCondition{{Value: "uploads/1/", Prefix: true}}; !reflect.DeepEqual(policy.Key, want) {
+		t.Errorf("key %+v, want %+v", policy.Key, want)
+	}
+	if want := []PolicyCondition{{Value: "audio/mpeg"}}; !reflect.DeepEqual(policy.ContentType, want) {
+		t.Errorf("content type %+v, want %+v", policy.ContentType, want)
+	}
+
+	allows := []struct {
+		field, value string
+		want         bool
+	}{
+		{"content-md5", "anything", true},
+		{"Content-MD5", "", true},
+		{"ACL", "private", true},
+		{"acl", "public-read", false},
+		{"x-amz-checksum-sha256", "", false},
+	}
+	for _, tt := range allows {
+		if got := policy.Allows(tt.field, tt.value); got != tt.want {
+			t.Errorf("Allows(%q, %q) = %v, want %v", tt.field, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParsePolicyDefaults(t *testing.T) {
+	policy, err := ParsePolicy(" " + encodePolicy(`{"conditions": []}`) + "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !policy.Expiration.IsZero() || policy.MinSize != 0 || policy.MaxSize != -1 {
+		t.Errorf("got %+v", policy)
+	}
+	if policy.ExpiresBefore(time.Now().Add(100 * 365 * 24 * time.Hour)) {
+		t.Error("a policy without expiration expires")
+	}
+	if err := policy.Check("any/key.mp3", "", 1<<40); err != nil {
+		t.Errorf("empty policy rejects: %v", err)
+	}
+}
+
+func TestParsePolicyErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{"not base64", "not base64!"},
+		{"not json", encodePolicy(`policy`)},
+		{"not an object", encodePolicy(`["eq", "$key", "a"]`)},
+		{"bad expiration", encodePolicy(`{"expiration": "tomorrow", "conditions": []}`)},
+		{"short condition", encodePolicy(`{"conditions": [["eq", "$key"]]}`)},
+		{"unknown operator", encodePolicy(`{"conditions": [["ends-with", "$key", ".mp3"]]}`)},
+		{"field without $", encodePolicy(`{"conditions": [["eq", "key", "a"]]}`)},
+		{"numeric value", encodePolicy(`{"conditions": [["eq", "$key", 5]]}`)},
+		{"bad range", encodePolicy(`{"conditions": [["content-length-range", "one", 10]]}`)},
+		{"scalar condition", encodePolicy(`{"conditions": ["key"]}`)},
+		{"object with a number", encodePolicy(`{"conditions": [{"success_action_status": 201}]}`)},
+	}
+	for _, tt := range tests {
+		if policy, err := ParsePolicy(tt.encoded); err == nil {
+			t.Errorf("%s: got %+v, want an error", tt.name, policy)
+		}
+	}
+}
+
+func TestPolicyCheck(t *testing.T) {
+	policy := &Policy{
+		MinSize:     10,
+		MaxSize:     1000,
+		Key:         []PolicyCondition{{Value: "uploads/1/", Prefix: true}},
+		ContentType: []PolicyCondition{{Value: "audio/", Prefix: true}},
+	}
+	tests := []struct {
+		name        string
+		key         string
+		contentType string
+		size        int64
+		wantErr     string
+	}{
+		{"ok", "uploads/1/a.mp3", "audio/mpeg", 500, ""},
+		{"limits", "uploads/1/a.mp3", "audio/mpeg", 1000, ""},
+		{"unknown size", "uploads/1/a.mp3", "audio/mpeg", -1, ""},
+		{"key", "uploads/2/a.mp3", "audio/mpeg", 500, `the key "uploads/2/a.mp3" must start with "uploads/1/"`},
+		{"content type", "uploads/1/a.mp3", "video/mp4", 500, `the content type "video/mp4" must start with "audio/"`},
+		{"too small", "uploads/1/a.mp3", "audio/mpeg", 9, "at least 10"},
+		{"too large", "uploads/1/a.mp3", "audio/mpeg", 1001, "at most 1000"},
+		{"empty file", "uploads/1/a.mp3", "audio/mpeg", 0, "at least 10"},
+	}
+	for _, tt := range tests {
+		err := policy.Check(tt.key, tt.contentType, tt.size)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%s: got %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+
+	exact := &Policy{MaxSize: -1, ContentType: []PolicyCondition{{Value: "audio/mpeg"}}}
+	if err := exact.Check("a.mp3", "audio/mpeg3", 5); err == nil || !strings.Contains(err.Error(), `must be "audio/mpeg"`) {
+		t.Errorf("exact condition: got %v", err)
+	}
+}
+
+func TestPolicyExpiresBefore(t *testing.T) {
+	expiration := time.Date(2021, 6, 3, 12, 0, 0, 0, time.UTC)
+	policy := &Policy{Expiration: expiration}
+	tests := []struct {
+		t    time.Time
+		want bool
+	}{
+		{expiration.Add(-time.Minute), false},
+		{expiration, false},
+		{expiration.Add(time.Second), true},
+	}
+	for _, tt := range tests {
+		if got := policy.ExpiresBefore(tt.t); got != tt.want {
+			t.Errorf("ExpiresBefore(%v) = %v, want %v", tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestContentTypeOf(t *testing.T) {
+	tests := map[string]string{
+		"a.mp3":       "audio/mpeg",
+		"b.M4B":       "audio/mp4",
+		"c.wav":       "audio/wav",
+		"d.unknown42": "application/octet-stream",
+		"noext":       "application/octet-stream",
+	}
+	for name, want := range tests {
+		if got := contentTypeOf(name); got != want {
+			t.Errorf("contentTypeOf(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package overcast
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RetryPolicy controls how failed S3 uploads are retried.
+//
+// Only transient failures are retried: connection resets, timeouts and 5xx
+// responses. Delays grow exponentially from InitialBackoff up to MaxBackoff,
+// with random jitter.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, values below 2 disable retries
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultRetryPolicy is reasonable for uploads over a flaky connection.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: 2 * time.Second,
+	MaxBackoff:     time.Minute,
+}
+
+// backoff returns the delay before the retry number `retry` (starting at 1).
+func (rp *RetryPolicy) backoff(retry int) time.Duration {
+	delay := rp.InitialBackoff
+	for i := 1; i < retry && delay < rp.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if rp.MaxBackoff > 0 && delay > rp.MaxBackoff {
+		delay = rp.MaxBackoff
+	}
+	if delay <= 0 {
+		return 0
+	}
+	// equal jitter: somewhere between delay/2 and delay
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// S3Error is an error response from the S3 bucket.
+type S3Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *S3Error) Error() string {
+	msg := fmt.Sprintf("Unexpected status code from amazon: %d", e.StatusCode)
+	if e.Code != "" {
+		msg += " " + e.Code
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// Temporary reports whether the request may succeed if repeated.
+func (e *S3Error) Temporary() bool {
+	switch e.Code {
+	case "SlowDown", "RequestTimeout", "InternalError", "ServiceUnavailable":
+		return true
+	}
+	return e.StatusCode >= 500
+}
+
+// Expired reports whether the upload was rejected because the policy or the
+// credentials of the form have expired.
+func (e *S3Error) Expired() bool {
+	switch e.Code {
+	case "ExpiredToken", "TokenRefreshRequired", "RequestExpired":
+		return true
+	case "AccessDenied":
+		// "Invalid according to Policy: Policy expired."
+		return strings.Contains(strings.ToLower(e.Message), "expired")
+	}
+	return false
+}
+
+// parseS3Error builds an S3Error from the response, the XML body is optional.
+func parseS3Error(resp *http.Response) *S3Error {
+	s3err := &S3Error{StatusCode: resp.StatusCode}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return s3err
+	}
+	var xmlErr struct {
+		Code    string
+		Message string
+	}
+	if xml.Unmarshal(body, &xmlErr) == nil {
+		s3err.Code = xmlErr.Code
+		s3err.Message = xmlErr.Message
+	}
+	return s3err
+}
+
+// isTransient reports whether the failed upload is worth retrying.
+func isTransient(err error) bool {
+	var s3err *S3Error
+	if errors.As(err, &s3err) {
+		return s3err.Temporary()
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF)
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,104 @@
+package overcast
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestBackoff(t *testing.T) {
+	rp := RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Second, MaxBackoff: 10 * time.Second}
+	tests := []struct {
+		retry int
+		max   time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{50, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			delay := rp.backoff(tt.retry)
+			if delay < tt.max/2 || delay > tt.max {
+				t.Errorf("backoff(%d) = %v, want between %v and %v", tt.retry, delay, tt.max/2, tt.max)
+			}
+		}
+	}
+
+	for _, rp := range []RetryPolicy{
+		{},
+		{InitialBackoff: -time.Second},
+		{InitialBackoff: time.Second, MaxBackoff: -time.Second},
+	} {
+		if delay := rp.backoff(3); delay < 0 || (rp.InitialBackoff <= 0 && delay != 0) {
+			t.Errorf("%+v: backoff(3) = %v", rp, delay)
+		}
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var _ net.Error = timeoutError{}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"slow down", &S3Error{StatusCode: 503, Code: "SlowDown"}, true},
+		{"internal error", &S3Error{StatusCode: 500}, true},
+		{"request timeout", &S3Error{StatusCode: 400, Code: "RequestTimeout"}, true},
+		{"wrapped 5xx", errors.Wrap(&S3Error{StatusCode: 502}, "upload"), true},
+		{"access denied", &S3Error{StatusCode: 403, Code: "AccessDenied"}, false},
+		{"too large", &S3Error{StatusCode: 400, Code: "EntityTooLarge"}, false},
+		{"timeout", &net.OpError{Op: "read", Err: timeoutError{}}, true},
+		{"reset", &net.OpError{Op: "write", Err: syscall.ECONNRESET}, true},
+		{"broken pipe", errors.WithMessage(syscall.EPIPE, "write"), true},
+		{"unexpected EOF", io.ErrUnexpectedEOF, true},
+		{"canceled", context.Canceled, false},
+		{"deadline", errors.Wrap(context.DeadlineExceeded, "upload"), false},
+		{"refused", syscall.ECONNREFUSED, false},
+		{"other", errors.New("no such file"), false},
+	}
+	for _, tt := range tests {
+		if got := isTransient(tt.err); got != tt.want {
+			t.Errorf("%s: isTransient(%v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestParseS3Error(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   S3Error
+	}{
+		{"xml", 403, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>AccessDenied</Code><Message>Policy expired.</Message></Error>`,
+			S3Error{403, "AccessDenied", "Policy expired."}},
+		{"empty", 503, "", S3Error{StatusCode: 503}},
+		{"html", 502, "<html><body>Bad Gateway</body></html>", S3Error{StatusCode: 502}},
+	}
+	for _, tt := range tests {
+		got := parseS3Error(&http.Response{StatusCode: tt.status, Body: ioutil.NopCloser(strings.NewReader(tt.body))})
+		if *got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, *got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,413 @@
+package overcast
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// File is a local file to be uploaded.
+type File struct {
+	// Path of the file on disk
+	Path string
+	// Name of the file on Overcast, becomes part of the S3 key
+	Name string
+	// Size of the file, only that many bytes are uploaded
+	Size int64
+	// SHA256, if set, is the hex encoded hash of the file. The uploaded data
+	// is hashed and compared with it.
+	SHA256 string
+	// Verify makes S3 check the data: its MD5 and SHA-256 are sent if the
+	// policy allows it, and compared with the ETag of the stored object
+	Verify bool
+	// Progress, if set, wraps the request body to track the upload.
+	// total is the size of the whole request, not just the file.
+	Progress func(total int64, body io.Reader) io.Reader
+	// OnRetry, if set, is called before waiting for the retry number
+	// `retry` (starting at 1) after a transient failure
+	OnRetry func(retry int, delay time.Duration, err error)
+	// OnRefresh, if set, is called before fetching a new upload form
+	// because the old one has expired
+	OnRefresh func()
+
+	// Key is set by Upload to the S3 key the file is stored under. The
+	// key prefix may change when the form is refreshed.
+	Key string
+}
+
+// FileChangedError is returned if the file was changed before or during
+// the upload, the uploaded data may be corrupt.
+type FileChangedError struct {
+	Path   string
+	Reason string
+}
+
+func (e *FileChangedError) Error() string {
+	return fmt.Sprintf("the file has changed: %s", e.Reason)
+}
+
+// checkUnchanged compares the file with its state before the upload, and
+// the hash of the uploaded data with the expected one, if both are known
+func (f *File) checkUnchanged(before os.FileInfo, expected, sent string) error {
+	after, err := os.Stat(f.Path)
+	switch {
+	case err != nil:
+		return &FileChangedError{f.Path, err.Error()}
+	case after.Size() != before.Size():
+		return &FileChangedError{f.Path, fmt.Sprintf("the size went from %d to %d bytes", before.Size(), after.Size())}
+	case !after.ModTime().Equal(before.ModTime()):
+		return &FileChangedError{f.Path, "it was modified at " + after.ModTime().Format("15:04:05")}
+	case expected != "" && sent != "" && sent != expected:
+		return &FileChangedError{f.Path, "the uploaded data doesn't match the hash"}
+	}
+	return nil
+}
+
+// Uploader uploads files using the form from the uploads page.
+//
+// The form is refreshed when its policy expires, so the PostData,
+// UploadURL, Policy, DataKeyPrefix and the limits of Params may be replaced
+// during the uploads. AllowedExts is kept, it may be set by the user.
+type Uploader struct {
+	Client *Client
+	Params *Params
+	Retry  RetryPolicy
+
+	// mu guards the form in Params
+	mu sync.Mutex
+}
+
+// policyExpiryMargin is how long before the expiration of the form the
+// uploads switch to a new one, S3 checks the policy once the file is sent
+const policyExpiryMargin = 10 * time.Minute
+
+// NewUploader returns an Uploader for the upload form described by params.
+// Failed uploads are retried according to DefaultRetryPolicy.
+func (c *Client) NewUploader(params *Params) *Uploader {
+	return &Uploader{
+		Client: c,
+		Params: params,
+		Retry:  DefaultRetryPolicy,
+	}
+}
+
+// Key returns the S3 key a file named name is stored under with the
+// current form.
+func (u *Uploader) Key(name string) string {
+	return u.form().key(name)
+}
+
+// key returns the S3 key of the file named name uploaded with the form
+func (form *Params) key(name string) string {
+	return form.DataKeyPrefix + name
+}
+
+// ContentType returns the Content-Type field sent with the file named name.
+// It's the one from the form, or the type of the file if the policy
+// requires one and the form doesn't set it.
+func (u *Uploader) ContentType(name string) string {
+	return contentTypeField(u.form(), name)
+}
+
+func contentTypeField(form *Params, name string) string {
+	if contentType := form.PostField("Content-Type"); contentType != "" {
+		return contentType
+	}
+	if form.Policy != nil && len(form.Policy.ContentType) != 0 {
+		return contentTypeOf(name)
+	}
+	return ""
+}
+
+// Check returns the reason the upload of the file named name of size bytes
+// (-1 if unknown) would be rejected by the policy of the form, nil if it's
+// allowed or the form has no policy. The expiration isn't checked, the form
+// is refreshed when it expires.
+func (u *Uploader) Check(name string, size int64) error {
+	return u.check(u.form(), name, size)
+}
+
+func (u *Uploader) check(form *Params, name string, size int64) error {
+	if form.Policy == nil {
+		return nil
+	}
+	return form.Policy.Check(form.key(name), contentTypeField(form, name), size)
+}
+
+// form returns a copy of the params with the current upload form
+func (u *Uploader) form() *Params {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	form := *u.Params
+	return &form
+}
+
+// refresh replaces the expired form with a new one from the uploads page.
+// The page is fetched once for all the uploads that used the same form.
+func (u *Uploader) refresh(ctx context.Context, expired *Params) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.Params.UploadURL != expired.UploadURL ||
+		u.Params.PostField("policy") != expired.PostField("policy") {
+		// already refreshed
+		return nil
+	}
+
+	page, err := u.Client.UploadsPage(ctx)
+	if err != nil {
+		return err
+	}
+	params, err := page.Params()
+	if err != nil {
+		return err
+	}
+	u.Params.PostData = params.PostData
+	u.Params.UploadURL = params.UploadURL
+	u.Params.Policy = params.Policy
+	u.Params.DataKeyPrefix = params.DataKeyPrefix
+	u.Params.SpaceAvailable = params.SpaceAvailable
+	u.Params.MaxFileCount = params.MaxFileCount
+	u.Params.MaxFileSize = params.MaxFileSize
+	return nil
+}
+
+// isExpired reports whether the upload failed because the form has expired
+func isExpired(err error) bool {
+	if errors.Is(err, ErrPolicyExpired) {
+		return true
+	}
+	var s3err *S3Error
+	return errors.As(err, &s3err) && s3err.Expired()
+}
+
+func dumpBytesFromBuf(byteBuf *bytes.Buffer) ([]byte, error) {
+	array := make([]byte, byteBuf.Len())
+	_, err := byteBuf.Read(array)
+	if err != nil {
+		return nil, err
+	}
+	return array, nil
+}
+
+// Upload sends the file to the S3 bucket. Overcast doesn't know about the
+// file until it's submitted.
+//
+// Transient failures are retried according to u.Retry, every attempt reads
+// the file from the start. If the form has expired, or is about to, a new
+// one is fetched with the current session and the upload is repeated.
+func (u *Uploader) Upload(ctx context.Context, f *File) (err error) {
+	refreshed := false
+	for attempt := 1; ; attempt++ {
+		form := u.form()
+		if !refreshed && form.Policy != nil && form.Policy.ExpiresBefore(time.Now().Add(policyExpiryMargin)) {
+			err = ErrPolicyExpired
+		} else {
+			err = u.upload(ctx, form, f)
+		}
+		if !refreshed && isExpired(err) {
+			// once per file, after that the new form is used whatever the
+			// local clock says
+			refreshed = true
+			if f.OnRefresh != nil {
+				f.OnRefresh()
+			}
+			if refreshErr := u.refresh(ctx, form); refreshErr != nil {
+				return errors.WithMessage(refreshErr, "failed to refresh the expired upload form")
+			}
+			attempt--
+			continue
+		}
+		if err == nil || attempt >= u.Retry.MaxAttempts || !isTransient(err) {
+			return
+		}
+
+		delay := u.Retry.backoff(attempt)
+		if f.OnRetry != nil {
+			f.OnRetry(attempt, delay, err)
+		}
+		if sleepErr := sleep(ctx, delay); sleepErr != nil {
+			return
+		}
+	}
+}
+
+// upload makes a single attempt to upload the file with the form.
+func (u *Uploader) upload(ctx context.Context, form *Params, f *File) (err error) {
+	err = u.check(form, f.Name, f.Size)
+	if err != nil {
+		return
+	}
+
+	//buffer for storing multipart data
+	byteBuf := &bytes.Buffer{}
+
+	//part: parameters
+	mpWriter := multipart.NewWriter(byteBuf)
+
+	for key, value := range form.PostData {
+		err = mpWriter.WriteField(key, value)
+		if err != nil {
+			return
+		}
+	}
+	if contentType := contentTypeField(form, f.Name); contentType != "" && form.PostField("Content-Type") == "" {
+		err = mpWriter.WriteField("Content-Type", contentType)
+		if err != nil {
+			return
+		}
+	}
+	expected := f.SHA256
+	if f.Verify && form.Policy != nil {
+		// the checksums go before the file, so it's read twice
+		var fileSums *checksums
+		for _, field := range checksumFields {
+			if !form.Policy.Allows(field.name, "") {
+				continue
+			}
+			if fileSums == nil {
+				fileSums, err = hashFile(f.Path, f.Size)
+				if err != nil {
+					return
+				}
+			}
+			err = mpWriter.WriteField(field.name, field.value(fileSums))
+			if err != nil {
+				return
+			}
+		}
+		if fileSums != nil && expected == "" {
+			expected = fileSums.SHA256()
+		}
+	}
+
+	_, err = mpWriter.CreateFormFile("file", f.Name)
+	if err != nil {
+		return
+	}
+	multipartStart, err := dumpBytesFromBuf(byteBuf)
+	if err != nil {
+		return
+	}
+	err = mpWriter.Close()
+	if err != nil {
+		return
+	}
+	multipartEnd, err := dumpBytesFromBuf(byteBuf)
+	if err != nil {
+		return
+	}
+
+	//calculate content length
+	totalSize := int64(len(multipartStart)) + f.Size + int64(len(multipartEnd))
+
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	before, err := file.Stat()
+	if err != nil {
+		return
+	}
+	if before.Size() != f.Size {
+		return &FileChangedError{f.Path, fmt.Sprintf("the size is %d bytes instead of %d", before.Size(), f.Size)}
+	}
+
+	// the file is checked after the upload, it's limited so that the
+	// request stays valid even if the file grows
+	var data io.Reader = io.LimitReader(file, f.Size)
+	var sentSums *checksums
+	if f.Verify || expected != "" {
+		sentSums = newChecksums()
+		data = io.TeeReader(data, sentSums)
+	}
+	var body io.Reader = io.MultiReader(
+		bytes.NewReader(multipartStart),
+		data,
+		bytes.NewReader(multipartEnd),
+	)
+	if f.Progress != nil {
+		body = f.Progress(totalSize, body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", form.UploadURL, body)
+	if err != nil {
+		return
+	}
+
+	req.Header.Set("Content-Type", mpWriter.FormDataContentType())
+	req.Header.Set("Origin", u.Client.origin())
+	req.ContentLength = totalSize
+
+	resp, err := u.Client.HTTPClient.Do(req)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	var sent string
+	if sentSums != nil && sentSums.size == f.Size {
+		// otherwise the request failed before the whole file was sent
+		sent = sentSums.SHA256()
+	}
+	// a changed file explains the failure, or makes the success worthless
+	if changedErr := f.checkUnchanged(before, expected, sent); changedErr != nil {
+		return changedErr
+	}
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode != 204 {
+		return parseS3Error(resp)
+	}
+	if f.Verify {
+		err = checkETag(resp.Header, sentSums)
+		if err != nil {
+			return
+		}
+	}
+	f.Key = form.key(f.Name)
+	return
+}
+
+// Submit tells Overcast about the file uploaded under key.
+func (u *Uploader) Submit(ctx context.Context, key string) (err error) {
+	byteBuf := &bytes.Buffer{}
+	mpWriter := multipart.NewWriter(byteBuf)
+
+	err = mpWriter.WriteField("key", key)
+	if err != nil {
+		return
+	}
+	err = mpWriter.Close()
+	if err != nil {
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", u.Client.url("podcasts/upload_succeeded"), byteBuf)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", mpWriter.FormDataContentType())
+	req.Header.Set("Origin", u.Client.origin())
+	req.ContentLength = int64(byteBuf.Len())
+
+	resp, err := u.Client.HTTPClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return errors.Errorf("Unexpected status code from overcast: %d", resp.StatusCode)
+	}
+
+	return
+}
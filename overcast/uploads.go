@@ -0,0 +1,163 @@
+package overcast
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Upload is a file already uploaded to the account, as listed on the
+// uploads page.
+type Upload struct {
+	Name string
+	// Size in bytes, -1 if unknown. The listing rounds it, see SizeMatches.
+	Size int64
+	// sizeStep is the value of the last digit of the listed size
+	sizeStep int64
+	// Date of the upload, zero if unknown
+	Date time.Time
+	// EpisodeURL is the episode page, empty if unknown
+	EpisodeURL string
+	// DeleteURL is where the delete form is posted, empty if the file
+	// can't be deleted
+	DeleteURL string
+	// DeleteData are the fields of the delete form
+	DeleteData map[string]string
+}
+
+// Selectors of the uploads listing. Every file is an episode cell with
+// the name in the title and "date • size" in the caption, optionally
+// accompanied by a delete form.
+const (
+	uploadCellSelector    = ".extendedepisodecell"
+	uploadTitleSelector   = ".title"
+	uploadCaptionSelector = ".caption2"
+	uploadDeleteSelector  = `form[action*="delete"]`
+)
+
+var uploadDateLayouts = []string{
+	"Jan 2, 2006",
+	"January 2, 2006",
+	"Jan 2",
+	"January 2",
+	"2006-01-02",
+}
+
+var reSize = regexp.MustCompile(`^([\d.,]+)\s*([KMGT]?B)$`)
+
+var sizeUnits = map[string]float64{
+	"B":  1,
+	"KB": 1e3,
+	"MB": 1e6,
+	"GB": 1e9,
+	"TB": 1e12,
+}
+
+// parseSize parses sizes like "54.2 MB", step is the value of the last
+// digit: 100 KB for "54.2 MB"
+func parseSize(s string) (size, step int64, ok bool) {
+	m := reSize.FindStringSubmatch(strings.ToUpper(s))
+	if m == nil {
+		return
+	}
+	number := strings.Replace(m[1], ",", "", -1)
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return
+	}
+	unit := sizeUnits[m[2]]
+	if dot := strings.IndexByte(number, '.'); dot >= 0 {
+		unit /= math.Pow10(len(number) - dot - 1)
+	}
+	step = int64(unit)
+	if step < 1 {
+		step = 1
+	}
+	return int64(math.Round(value * sizeUnits[m[2]])), step, true
+}
+
+// SizeMatches reports whether the listed size is size rounded, it's true if
+// the size is unknown.
+func (u *Upload) SizeMatches(size int64) bool {
+	if u.Size < 0 || size < 0 {
+		return true
+	}
+	diff := u.Size - size
+	if diff < 0 {
+		diff = -diff
+	}
+	// allow for both rounding and truncation
+	return diff == 0 || diff < u.sizeStep
+}
+
+// parseDate parses dates like "Jun 3, 2021". Dates without a year are
+// assumed to be in the past year.
+func parseDate(s string, now time.Time) (date time.Time, ok bool) {
+	for _, layout := range uploadDateLayouts {
+		date, err := time.ParseInLocation(layout, s, time.Local)
+		if err != nil {
+			continue
+		}
+		if date.Year() == 0 {
+			date = date.AddDate(now.Year(), 0, 0)
+			if date.After(now) {
+				date = date.AddDate(-1, 0, 0)
+			}
+		}
+		return date, true
+	}
+	return
+}
+
+// Uploads lists the files already uploaded to the account.
+func (p *UploadsPage) Uploads() (uploads []*Upload) {
+	now := time.Now()
+	p.doc.Find(uploadCellSelector).Each(func(i int, cell *goquery.Selection) {
+		upload := &Upload{
+			Name: strings.TrimSpace(cell.Find(uploadTitleSelector).First().Text()),
+			Size: -1,
+		}
+		if upload.Name == "" {
+			return
+		}
+
+		if href, found := cell.Attr("href"); found {
+			upload.EpisodeURL = p.resolve(href)
+		}
+
+		for _, part := range strings.Split(cell.Find(uploadCaptionSelector).First().Text(), "•") {
+			part = strings.TrimSpace(part)
+			if size, step, ok := parseSize(part); ok {
+				upload.Size, upload.sizeStep = size, step
+			} else if date, ok := parseDate(part, now); ok {
+				upload.Date = date
+			}
+		}
+
+		// the form is either inside the cell or next to it
+		form := cell.Find(uploadDeleteSelector)
+		if form.Length() == 0 {
+			form = cell.Parent().Find(uploadDeleteSelector)
+		}
+		if form.Length() == 1 {
+			if action, found := form.Attr("action"); found {
+				upload.DeleteURL = p.resolve(action)
+				upload.DeleteData = make(map[string]string)
+				form.Find(`input[type="hidden"]`).Each(func(i int, s *goquery.Selection) {
+					name, nameFound := s.Attr("name")
+					val, valueFound := s.Attr("value")
+					if nameFound && valueFound {
+						upload.DeleteData[name] = val
+					}
+				})
+			}
+		}
+
+		uploads = append(uploads, upload)
+	})
+	return
+}
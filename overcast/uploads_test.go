@@ -0,0 +1,146 @@
+package overcast
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		size int64
+		step int64
+		ok   bool
+	}{
+		{"54.2 MB", 54200000, 100000, true},
+		{"54.2 mb", 54200000, 100000, true},
+		{"12MB", 12000000, 1000000, true},
+		{"1,234.5 KB", 1234500, 100, true},
+		{"1.25 GB", 1250000000, 10000000, true},
+		{"512 B", 512, 1, true},
+		{"0.001 KB", 1, 1, true},
+		{"2 TB", 2e12, 1e12, true},
+		{"", 0, 0, false},
+		{"MB", 0, 0, false},
+		{"12 PB", 0, 0, false},
+		{"1.2.3 MB", 0, 0, false},
+		{"about 5 MB", 0, 0, false},
+		{"Jun 3, 2021", 0, 0, false},
+	}
+	for _, tt := range tests {
+		size, step, ok := parseSize(tt.in)
+		if size != tt.size || step != tt.step || ok != tt.ok {
+			t.Errorf("parseSize(%q) = %d, %d, %v, want %d, %d, %v", tt.in, size, step, ok, tt.size, tt.step, tt.ok)
+		}
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	now := time.Date(2021, 6, 15, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		in   string
+		want time.Time
+		ok   bool
+	}{
+		{"Jun 3, 2021", time.Date(2021, 6, 3, 0, 0, 0, 0, time.Local), true},
+		{"December 24, 2020", time.Date(2020, 12, 24, 0, 0, 0, 0, time.Local), true},
+		{"2019-02-28", time.Date(2019, 2, 28, 0, 0, 0, 0, time.Local), true},
+		// without a year it's the last such date
+		{"Jun 1", time.Date(2021, 6, 1, 0, 0, 0, 0, time.Local), true},
+		{"Dec 31", time.Date(2020, 12, 31, 0, 0, 0, 0, time.Local), true},
+		{"", time.Time{}, false},
+		{"yesterday", time.Time{}, false},
+		{"Jun 31, 2021", time.Time{}, false},
+		{"54.2 MB", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseDate(tt.in, now)
+		if !got.Equal(tt.want) || ok != tt.ok {
+			t.Errorf("parseDate(%q) = %v, %v, want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+const uploadsHTML = `<html><body>
+<div class="upload">
+<a class="extendedepisodecell" href="/+U1"><div class="title">First.mp3</div><div class="caption2">Jun 3, 2021 &bull; 54.2 MB</div></a>
+<form method="post" action="/uploads/delete"><input type="hidden" name="id" value="1"></form>
+</div>
+<div class="upload">
+<a class="extendedepisodecell" href="https://overcast.fm/+U2"><div class="title"> Second.m4a </div><div class="caption2">12 KB</div></a>
+</div>
+<div class="upload">
+<a class="extendedepisodecell"><div class="title"></div><div class="caption2">Jun 3, 2021 &bull; 1 MB</div></a>
+</div>
+<div class="upload">
+<a class="extendedepisodecell"><div class="title">Third.mp3</div><div class="caption2">processing</div></a>
+</div>
+</body></html>`
+
+func TestUploads(t *testing.T) {
+	page, err := ParseUploadsPage(strings.NewReader(uploadsHTML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page.url, _ = url.Parse("https://overcast.fm/uploads")
+	uploads := page.Uploads()
+	if len(uploads) != 3 {
+		t.Fatalf("got %d uploads, want 3 (the one without a name is skipped)", len(uploads))
+	}
+
+	first := uploads[0]
+	if first.Name != "First.mp3" || first.Size != 54200000 ||
+		!first.Date.Equal(time.Date(2021, 6, 3, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("first: %+v", first)
+	}
+	if first.EpisodeURL != "https://overcast.fm/+U1" || first.DeleteURL != "https://overcast.fm/uploads/delete" ||
+		first.DeleteData["id"] != "1" {
+		t.Errorf("first links: %q, %q, %v", first.EpisodeURL, first.DeleteURL, first.DeleteData)
+	}
+
+	second := uploads[1]
+	if second.Name != "Second.m4a" || second.Size != 12000 || !second.Date.IsZero() || second.DeleteURL != "" {
+		t.Errorf("second: %+v", second)
+	}
+
+	third := uploads[2]
+	if third.Name != "Third.mp3" || third.Size != -1 || !third.Date.IsZero() {
+		t.Errorf("third: %+v", third)
+	}
+}
+
+func TestSizeMatches(t *testing.T) {
+	tests := []struct {
+		listed string
+		size   int64
+		want   bool
+	}{
+		{"54.2 MB", 54200000, true},
+		{"54.2 MB", 54249999, true},
+		{"54.2 MB", 54150001, true},
+		{"54.2 MB", 54299999, true}, // truncated
+		{"54.2 MB", 54300000, false},
+		{"54.2 MB", 54100000, false},
+		{"12 KB", 12499, true},
+		{"12 KB", 13000, false},
+		{"512 B", 512, true},
+		{"512 B", 513, false},
+		{"1 MB", -1, true},
+	}
+	for _, tt := range tests {
+		upload := &Upload{Size: -1}
+		var ok bool
+		upload.Size, upload.sizeStep, ok = parseSize(tt.listed)
+		if !ok {
+			t.Fatalf("parseSize(%q) failed", tt.listed)
+		}
+		if got := upload.SizeMatches(tt.size); got != tt.want {
+			t.Errorf("%q.SizeMatches(%d) = %v, want %v", tt.listed, tt.size, got, tt.want)
+		}
+	}
+	if unknown := (&Upload{Size: -1}); !unknown.SizeMatches(100) {
+		t.Error("an unknown size doesn't match")
+	}
+}
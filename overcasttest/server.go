@@ -0,0 +1,535 @@
+// Package overcasttest implements a fake Overcast website and S3 bucket for
+// testing uploads without network access.
+//
+//	srv := overcasttest.NewServer()
+//	defer srv.Close()
+//	oc, _ := overcast.NewClient(nil, srv.URL)
+//	page, _ := oc.Login(ctx, &overcast.Creds{Email: srv.Email, Password: srv.Password})
+//	...
+//	srv.Submitted() // keys passed to upload_succeeded
+package overcasttest
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const sessionCookie = "o"
+
+// Server is a fake Overcast website with the uploads page and a fake
+// presigned-POST S3 endpoint at /s3/.
+//
+// Exported fields may be set before the first request, use Update to change
+// them while the requests are served.
+type Server struct {
+	*httptest.Server
+
+	// Credentials accepted by the login form
+	Email    string
+	Password string
+
+	// Limits shown on the uploads page
+	FreeBytes int64
+	MaxBytes  int64
+	MaxFiles  int
+
+	// KeyPrefix is the data-key-prefix of the upload form
+	KeyPrefix string
+	// Accept is the accept attribute of the file input, omitted if empty
+	Accept string
+	// PolicyTTL is how long the upload form is valid, the uploads made
+	// with an expired form are rejected like S3 does
+	PolicyTTL time.Duration
+	// ContentTypePrefix, if set, is required by the policy to start the
+	// Content-Type field of the uploads
+	ContentTypePrefix string
+
+	// FailUploads is the number of upcoming S3 uploads to reject with
+	// 503 SlowDown, for testing retries
+	FailUploads int
+	// FailSubmits is the number of upcoming upload_succeeded calls to
+	// reject with 500
+	FailSubmits int
+	// ContentMD5, if set, lets the policy accept the Content-MD5 field and
+	// the uploads are checked against it
+	ContentMD5 bool
+	// CorruptUploads is the number of upcoming S3 uploads to store with a
+	// damaged byte, the ETag is the MD5 of the damaged data
+	CorruptUploads int
+	// LoseSubmits is the number of upcoming upload_succeeded calls to
+	// accept without listing the file
+	LoseSubmits int
+	// OnUpload, if set, is called with the key of every S3 upload once the
+	// file is received, before the reply. The server isn't locked.
+	OnUpload func(key string)
+
+	mu          sync.Mutex
+	sessions    map[string]bool
+	objects     map[string][]byte
+	fields      map[string]map[string]string
+	submitted   []string
+	uploads     []*Upload
+	nextSession int
+	nextUpload  int
+}
+
+// Upload is a file listed on the uploads page.
+type Upload struct {
+	ID   int
+	Name string
+	Size int64
+	Date time.Time
+}
+
+// NewServer starts a fake Overcast with default limits. Call Close when done.
+func NewServer() *Server {
+	s := &Server{
+		Email:     "user@example.com",
+		Password:  "password",
+		FreeBytes: 2 * 1000 * 1000 * 1000,
+		MaxBytes:  500 * 1000 * 1000,
+		MaxFiles:  50,
+		KeyPrefix: "uploads/1/",
+		Accept:    "audio/mpeg,audio/mp4,audio/x-m4a,audio/aac,audio/wav,.m4b",
+		PolicyTTL: time.Hour,
+		sessions:  make(map[string]bool),
+		objects:   make(map[string][]byte),
+		fields:    make(map[string]map[string]string),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", s.handleLogin)
+	mux.HandleFunc("/uploads", s.handleUploads)
+	mux.HandleFunc("/uploads/delete", s.handleDelete)
+	mux.HandleFunc("/podcasts/upload_succeeded", s.handleUploadSucceeded)
+	mux.HandleFunc("/s3/", s.handleS3)
+
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Update calls change with the server locked, so the exported fields can be
+// changed safely while the requests are served.
+func (s *Server) Update(change func(s *Server)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	change(s)
+}
+
+// Submitted returns the keys passed to upload_succeeded, in order.
+func (s *Server) Submitted() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.submitted...)
+}
+
+// Uploads returns the files listed on the uploads page.
+func (s *Server) Uploads() []Upload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := make([]Upload, len(s.uploads))
+	for i, upload := range s.uploads {
+		res[i] = *upload
+	}
+	return res
+}
+
+// AddUpload lists the file on the uploads page, as if it was uploaded at date.
+func (s *Server) AddUpload(name string, size int64, date time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addUpload(name, size, date)
+}
+
+func (s *Server) addUpload(name string, size int64, date time.Time) {
+	s.nextUpload++
+	s.uploads = append(s.uploads, &Upload{
+		ID:   s.nextUpload,
+		Name: name,
+		Size: size,
+		Date: date,
+	})
+}
+
+// Object returns the contents of the file uploaded to S3 under key.
+func (s *Server) Object(key string) (data []byte, found bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, found = s.objects[key]
+	return
+}
+
+// Fields returns the form fields sent with the file uploaded to S3 under
+// key, nil if there is none.
+func (s *Server) Fields(key string) map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fields[key] == nil {
+		return nil
+	}
+	fields := make(map[string]string, len(s.fields[key]))
+	for name, value := range s.fields[key] {
+		fields[name] = value
+	}
+	return fields
+}
+
+func (s *Server) loggedIn(r *http.Request) bool {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions[cookie.Value]
+}
+
+var loginTmpl = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html><body>
+{{if .}}<div class="error">{{.}}</div>{{end}}
+<form method="post" action="/login">
+<input type="hidden" name="then" value="uploads">
+<input type="email" name="email">
+<input type="password" name="password">
+<input type="submit" value="Log In">
+</form>
+</body></html>
+`))
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		loginTmpl.Execute(w, "")
+	case "POST":
+		s.mu.Lock()
+		ok := r.PostFormValue("email") == s.Email && r.PostFormValue("password") == s.Password
+		var session string
+		if ok {
+			s.nextSession++
+			session = fmt.Sprintf("session-%d", s.nextSession)
+			s.sessions[session] = true
+		}
+		s.mu.Unlock()
+
+		if !ok {
+			loginTmpl.Execute(w, "Wrong email or password")
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: session, Path: "/"})
+		then := r.PostFormValue("then")
+		if then == "" {
+			then = "podcasts"
+		}
+		http.Redirect(w, r, "/"+then, http.StatusFound)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// formatSize formats the size like Overcast does
+func formatSize(size int64) string {
+	switch {
+	case size >= 1e9:
+		return fmt.Sprintf("%.1f GB", float64(size)/1e9)
+	case size >= 1e6:
+		return fmt.Sprintf("%.1f MB", float64(size)/1e6)
+	case size >= 1e3:
+		return fmt.Sprintf("%.1f KB", float64(size)/1e3)
+	}
+	return fmt.Sprintf("%d B", size)
+}
+
+var uploadsTmpl = template.Must(template.New("uploads").Funcs(template.FuncMap{
+	"size": formatSize,
+}).Parse(`<!DOCTYPE html>
+<html><body>
+<form id="upload_form" method="post" enctype="multipart/form-data" action="{{.UploadURL}}" data-key-prefix="{{.KeyPrefix}}">
+{{range $name, $value := .PostData}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}<input type="file" id="upload_file" name="file"{{with .Accept}} accept="{{.}}"{{end}} data-free-bytes="{{.FreeBytes}}" data-max-bytes="{{.MaxBytes}}"><div class="caption2">You can upload up to {{.MaxFiles}} more files.</div>
+</form>
+<div id="uploads">
+{{range .Uploads}}<div class="upload">
+<a class="extendedepisodecell" href="/+U{{.ID}}"><div class="titlestack"><div class="title singleline">{{.Name}}</div><div class="caption2 singleline">{{.Date.Format "Jan 2, 2006"}} &bull; {{size .Size}}</div></div></a>
+<form class="delete_upload" method="post" action="/uploads/delete"><input type="hidden" name="id" value="{{.ID}}"><input type="submit" value="Delete"></form>
+</div>
+{{end}}</div>
+</body></html>
+`))
+
+const policyTimeLayout = "2006-01-02T15:04:05.000Z"
+
+// policyExpired reports whether the base64-encoded policy has expired
+func policyExpired(encoded string) bool {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return false
+	}
+	var policy struct {
+		Expiration string `json:"expiration"`
+	}
+	if json.Unmarshal(data, &policy) != nil {
+		return false
+	}
+	expiration, err := time.Parse(policyTimeLayout, policy.Expiration)
+	return err == nil && !time.Now().Before(expiration)
+}
+
+// policy returns base64-encoded S3 POST policy for the upload form.
+func (s *Server) policy() string {
+	policy := map[string]interface{}{
+		"expiration": time.Now().Add(s.PolicyTTL).UTC().Format(policyTimeLayout),
+		"conditions": []interface{}{
+			map[string]string{"bucket": "overcasttest"},
+			[]interface{}{"starts-with", "$key", s.KeyPrefix},
+			map[string]string{"acl": "private"},
+			map[string]string{"success_action_status": "204"},
+			[]interface{}{"content-length-range", 0, s.MaxBytes},
+		},
+	}
+	if s.ContentMD5 {
+		policy["conditions"] = append(policy["conditions"].([]interface{}),
+			[]interface{}{"starts-with", "$Content-MD5", ""},
+		)
+	}
+	if s.ContentTypePrefix != "" {
+		policy["conditions"] = append(policy["conditions"].([]interface{}),
+			[]interface{}{"starts-with", "$Content-Type", s.ContentTypePrefix},
+		)
+	}
+	data, err := json.Marshal(policy)
+	if err != nil {
+		panic(err)
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func (s *Server) handleUploads(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		http.Redirect(w, r, "/login?then=uploads", http.StatusFound)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data := map[string]interface{}{
+		"UploadURL": s.URL + "/s3/",
+		"KeyPrefix": s.KeyPrefix,
+		"PostData": map[string]string{
+			"key":                   s.KeyPrefix + "${filename}",
+			"acl":                   "private",
+			"success_action_status": "204",
+			"AWSAccessKeyId":        "AKIAOVERCASTTEST",
+			"policy":                s.policy(),
+			"signature":             "c2lnbmF0dXJl",
+		},
+		"FreeBytes": s.FreeBytes,
+		"MaxBytes":  s.MaxBytes,
+		"MaxFiles":  s.MaxFiles,
+		"Accept":    s.Accept,
+		"Uploads":   s.uploads,
+	}
+	uploadsTmpl.Execute(w, data)
+}
+
+func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.loggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+	id, err := strconv.Atoi(r.PostFormValue("id"))
+	if err != nil {
+		http.Error(w, "bad id", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	found := false
+	for i, upload := range s.uploads {
+		if upload.ID == id {
+			s.uploads = append(s.uploads[:i], s.uploads[i+1:]...)
+			s.FreeBytes += upload.Size
+			s.MaxFiles++
+			found = true
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	if !found {
+		http.Error(w, "upload not found", http.StatusNotFound)
+		return
+	}
+	http.Redirect(w, r, "/uploads", http.StatusFound)
+}
+
+// s3Error replies with an S3-style XML error.
+func s3Error(w http.ResponseWriter, statusCode int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(statusCode)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{
+		Code:    code,
+		Message: message,
+	})
+}
+
+// handleS3 accepts a presigned POST upload, like S3 would.
+func (s *Server) handleS3(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		s3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource.")
+		return
+	}
+
+	s.mu.Lock()
+	fail := s.FailUploads > 0
+	if fail {
+		s.FailUploads--
+	}
+	s.mu.Unlock()
+	if fail {
+		s3Error(w, http.StatusServiceUnavailable, "SlowDown", "Please reduce your request rate.")
+		return
+	}
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		s3Error(w, http.StatusBadRequest, "MalformedPOSTRequest", err.Error())
+		return
+	}
+
+	fields := make(map[string]string)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			s3Error(w, http.StatusBadRequest, "InvalidArgument", "POST requires exactly one file upload per request.")
+			return
+		}
+		if err != nil {
+			s3Error(w, http.StatusBadRequest, "MalformedPOSTRequest", err.Error())
+			return
+		}
+
+		if part.FormName() != "file" {
+			value, err := ioutil.ReadAll(part)
+			if err != nil {
+				s3Error(w, http.StatusBadRequest, "MalformedPOSTRequest", err.Error())
+				return
+			}
+			fields[part.FormName()] = string(value)
+			continue
+		}
+
+		// S3 ignores everything after the file
+		data, err := ioutil.ReadAll(part)
+		if err != nil {
+			s3Error(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+		key := strings.Replace(fields["key"], "${filename}", part.FileName(), -1)
+
+		s.mu.Lock()
+		onUpload := s.OnUpload
+		s.mu.Unlock()
+		if onUpload != nil {
+			onUpload(key)
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if fields["policy"] == "" || fields["signature"] == "" {
+			s3Error(w, http.StatusForbidden, "AccessDenied", "Bucket POST must contain a field named 'policy'.")
+			return
+		}
+		if policyExpired(fields["policy"]) {
+			s3Error(w, http.StatusForbidden, "AccessDenied", "Invalid according to Policy: Policy expired.")
+			return
+		}
+		if !strings.HasPrefix(key, s.KeyPrefix) {
+			s3Error(w, http.StatusForbidden, "AccessDenied", `Invalid according to Policy: Policy Condition failed: ["starts-with", "$key", "`+s.KeyPrefix+`"]`)
+			return
+		}
+		if s.ContentTypePrefix != "" && !strings.HasPrefix(fields["Content-Type"], s.ContentTypePrefix) {
+			s3Error(w, http.StatusForbidden, "AccessDenied", `Invalid according to Policy: Policy Condition failed: ["starts-with", "$Content-Type", "`+s.ContentTypePrefix+`"]`)
+			return
+		}
+		if int64(len(data)) > s.MaxBytes {
+			s3Error(w, http.StatusBadRequest, "EntityTooLarge", "Your proposed upload exceeds the maximum allowed size")
+			return
+		}
+
+		if s.ContentMD5 && fields["Content-MD5"] != "" {
+			sum := md5.Sum(data)
+			if fields["Content-MD5"] != base64.StdEncoding.EncodeToString(sum[:]) {
+				s3Error(w, http.StatusBadRequest, "BadDigest", "The Content-MD5 you specified did not match what we received.")
+				return
+			}
+		}
+		if s.CorruptUploads > 0 && len(data) != 0 {
+			s.CorruptUploads--
+			data[len(data)/2] ^= 0xff
+		}
+
+		s.objects[key] = data
+		s.fields[key] = fields
+		sum := md5.Sum(data)
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+}
+
+func (s *Server) handleUploadSucceeded(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.loggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+	key := r.FormValue("key")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.FailSubmits > 0 {
+		s.FailSubmits--
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	data, found := s.objects[key]
+	if !found {
+		http.Error(w, "upload not found", http.StatusNotFound)
+		return
+	}
+	s.submitted = append(s.submitted, key)
+	if s.LoseSubmits > 0 {
+		s.LoseSubmits--
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	s.addUpload(strings.TrimPrefix(key, s.KeyPrefix), int64(len(data)), time.Now())
+	s.FreeBytes -= int64(len(data))
+	s.MaxFiles--
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Andrew-Morozko/cloudy-uploader/media"
+	"github.com/Andrew-Morozko/cloudy-uploader/overcast"
+	"github.com/pkg/errors"
+	"github.com/vbauerster/mpb/v4/decor"
+)
+
+// Preparation describes how the uploaded file is made from the local one.
+// It's saved in the queue, so the resumed jobs are prepared the same way.
+type Preparation struct {
+	// Start and Length select the part of the file to upload, the whole file
+	// is uploaded if Length is zero
+	Start  time.Duration `json:",omitempty"`
+	Length time.Duration `json:",omitempty"`
+	// Metadata are the tags replaced in the uploaded file
+	Metadata map[string]string `json:",omitempty"`
+	// Transcode is the command converting the file into the uploaded format
+	Transcode media.Command `json:",omitempty"`
+	// Concat are the files joined into the uploaded one. The audio is
+	// encoded in ConcatFormat, or copied if it's empty.
+	// Chapters are written into the uploaded file, for the joined files
+	// they mark where each of them starts.
+	Concat       []string        `json:",omitempty"`
+	Chapters     []media.Chapter `json:",omitempty"`
+	ConcatFormat string          `json:",omitempty"`
+	// Normalize is the target loudness in LUFS, zero if the loudness isn't
+	// changed
+	Normalize float64 `json:",omitempty"`
+	// Tags and Artwork are set by the user, they are written last
+	Tags    map[string]string `json:",omitempty"`
+	Artwork string            `json:",omitempty"`
+}
+
+// PrepareArgs are the options changing the uploaded files
+type PrepareArgs struct {
+	Transcode       bool    `arg:"--transcode" help:"convert the files of unsupported types instead of skipping them"`
+	TranscodeFormat string  `arg:"--transcode-format" help:"format of the converted files: m4a or mp3" default:"m4a" placeholder:"FORMAT"`
+	TranscodeCmd    string  `arg:"--transcode-cmd" help:"command converting {in} into {out}, ffmpeg by default" placeholder:"CMD"`
+	SplitOversize   bool    `arg:"--split-oversize" help:"split the files larger than the max file size into parts"`
+	SplitAt         string  `arg:"--split-at" help:"where to split the files: silence (near the even split points) or time (exactly at them)" default:"silence" placeholder:"MODE"`
+	SplitChapters   bool    `arg:"--split-chapters" help:"upload every chapter as a separate file, the chapters are read from the file or from a .cue file next to it"`
+	Normalize       float64 `arg:"--normalize" help:"normalize the loudness to the target, like -16 LUFS, with the two-pass ffmpeg loudnorm" placeholder:"LUFS"`
+	Concat          bool    `arg:"--concat" help:"join the files into one episode with a chapter for every file"`
+	ConcatName      string  `arg:"--concat-name" help:"name of the joined episode, the name of the first file by default" placeholder:"NAME"`
+
+	transcodeCmd media.Command
+}
+
+func (args *PrepareArgs) Validate() (err error) {
+	if args.SplitOversize && args.SplitAt != "silence" && args.SplitAt != "time" {
+		return errors.New("--split-at should be silence or time")
+	}
+	if args.Concat && (args.SplitOversize || args.SplitChapters) {
+		return errors.New("--concat can't be used with --split-oversize or --split-chapters")
+	}
+	if args.ConcatName != "" && !args.Concat {
+		return errors.New("--concat-name requires --concat")
+	}
+	if args.Normalize != 0 && (args.Normalize < -70 || args.Normalize > -5) {
+		return errors.New("--normalize should be between -70 and -5 LUFS")
+	}
+	if args.SplitOversize || args.SplitChapters || args.Concat || args.Normalize != 0 {
+		for _, tool := range []string{media.FFmpeg, media.FFprobe} {
+			if _, err = exec.LookPath(tool); err != nil {
+				return errors.Errorf("%s not found, it's needed to split, join or normalize the files", tool)
+			}
+		}
+	}
+	if !args.Transcode {
+		return nil
+	}
+	found := false
+	for _, format := range media.Formats {
+		found = found || format == args.TranscodeFormat
+	}
+	if !found {
+		return errors.Errorf("--transcode-format should be one of: %s", strings.Join(media.Formats, ", "))
+	}
+	if args.TranscodeCmd != "" {
+		args.transcodeCmd, err = media.ParseCommand(args.TranscodeCmd)
+		if err == nil {
+			err = args.transcodeCmd.Check("in", "out")
+		}
+		if err != nil {
+			return errors.WithMessage(err, "invalid --transcode-cmd")
+		}
+	} else {
+		args.transcodeCmd, err = media.DefaultTranscodeCommand(args.TranscodeFormat)
+		if err != nil {
+			return
+		}
+	}
+	if _, err = exec.LookPath(args.transcodeCmd[0]); err != nil {
+		return errors.Errorf("%s not found, install it or set --transcode-cmd", args.transcodeCmd[0])
+	}
+	return nil
+}
+
+// tempDir holds the prepared files until they are uploaded. The folder is
+// created on the first use.
+type tempDir struct {
+	path string
+	lock sync.Mutex
+	n    int
+}
+
+// File returns a new path for the file with the name
+func (td *tempDir) File(name string) (string, error) {
+	td.lock.Lock()
+	defer td.lock.Unlock()
+	if td.path == "" {
+		path, err := os.MkdirTemp("", appName+"-")
+		if err != nil {
+			return "", errors.Wrap(err, "can't create temporary folder")
+		}
+		td.path = path
+	}
+	td.n++
+	return filepath.Join(td.path, fmt.Sprintf("%03d-%s", td.n, name)), nil
+}
+
+// Remove deletes the folder with all the files
+func (td *tempDir) Remove() {
+	td.lock.Lock()
+	defer td.lock.Unlock()
+	if td.path != "" {
+		os.RemoveAll(td.path)
+	}
+}
+
+// prepare makes the file to upload, updating the job's status. Every step
+// reads the result of the previous one, the intermediate files are removed.
+func (job *Job) prepare(ctx context.Context, td *tempDir) (err error) {
+	prep := job.Prep
+	in := job.File
+	step := func(status, name string, run func(out string, progress media.Progress) error) error {
+		out, err := td.File(name)
+		if err != nil {
+			return err
+		}
+		job.prepStatus.SetStatus(status)
+		err = run(out, func(done float64) {
+			job.prepStatus.SetStatus(fmt.Sprintf("%s %.0f%%", status, done*100))
+		})
+		if in != job.File {
+			os.Remove(in)
+		}
+		if err != nil {
+			os.Remove(out)
+			return errors.WithMessage(err, strings.ToLower(status)+" failed")
+		}
+		in = out
+		return nil
+	}
+
+	if len(prep.Concat) != 0 {
+		err = step("Joining", job.FileName, func(out string, progress media.Progress) error {
+			return media.Concat(ctx, prep.Concat, out, prep.Metadata, prep.Chapters, prep.ConcatFormat, progress)
+		})
+		if err != nil {
+			return
+		}
+	}
+	if prep.Length != 0 {
+		name := job.FileName
+		if prep.Transcode != nil {
+			// keep the original format until it's transcoded
+			name = strings.TrimSuffix(name, filepath.Ext(name)) + filepath.Ext(job.File)
+		}
+		err = step("Cutting", name, func(out string, progress media.Progress) error {
+			return media.Cut(ctx, in, out, prep.Start, prep.Length, prep.Metadata, progress)
+		})
+		if err != nil {
+			return
+		}
+	}
+	if prep.Transcode != nil {
+		err = step("Transcoding", job.FileName, func(out string, progress media.Progress) error {
+			return media.Transcode(ctx, prep.Transcode, in, out, progress)
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	if prep.Normalize != 0 {
+		var measured, result *media.Loudness
+		err = step("Normalizing", job.FileName, func(out string, progress media.Progress) (err error) {
+			// the passes take about the same time
+			measured, err = media.MeasureLoudness(ctx, in, prep.Normalize, func(done float64) {
+				progress(done / 2)
+			})
+			if err != nil {
+				return
+			}
+			result, err = media.Normalize(ctx, in, out, prep.Normalize, measured, func(done float64) {
+				progress(0.5 + done/2)
+			})
+			return
+		})
+		if err != nil {
+			return
+		}
+		job.levels = fmt.Sprintf("%.1f -> %.1f LUFS", measured.Integrated, result.Integrated)
+	}
+
+	var chapters []media.Chapter
+	if len(prep.Concat) == 0 {
+		// the joined files already have them
+		chapters = prep.Chapters
+	}
+	artwork := prep.Artwork
+	if artwork != "" {
+		artwork, err = fitArtwork(ctx, artwork, td)
+		if err != nil {
+			return
+		}
+		if artwork != prep.Artwork {
+			defer os.Remove(artwork)
+		}
+	}
+	if len(prep.Tags) != 0 || artwork != "" || chapters != nil {
+		err = step("Tagging", job.FileName, func(out string, progress media.Progress) error {
+			return media.Tag(ctx, in, out, prep.Tags, artwork, chapters, progress)
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	stat, err := os.Stat(in)
+	if err != nil {
+		return
+	}
+	if in != job.File {
+		job.uploadFile = in
+	}
+	job.uploadSize = stat.Size()
+	job.sizeStatus.SetStatus(formatSize(job.uploadSize))
+	if job.levels != "" {
+		job.prepStatus.SetStatus("Waiting, " + job.levels)
+	} else {
+		job.prepStatus.SetStatus("Waiting")
+	}
+	return nil
+}
+
+// normalizeJobs sets the jobs to be normalized to the target loudness. The
+// files are encoded again, so their sizes are unknown until then.
+func normalizeJobs(jobs []*Job, target float64) {
+	for _, job := range jobs {
+		if job.Prep == nil {
+			job.Prep = &Preparation{}
+		}
+		job.Prep.Normalize = target
+		job.uploadSize = -1
+	}
+}
+
+// prepareJobs prepares the jobs at most parallel at a time. Jobs that
+// failed or became too large are finished with an error.
+func prepareJobs(ctx context.Context, jobs []*Job, params *overcast.Params, parallel int, td *tempDir) {
+	permits := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		if job.Prep == nil || job.uploaded || job.isDone {
+			continue
+		}
+		wg.Add(1)
+		permits <- struct{}{}
+		go func(job *Job) {
+			defer func() {
+				<-permits
+				wg.Done()
+			}()
+			err := job.prepare(ctx, td)
+			if err != nil {
+				job.SetError(err.Error())
+				return
+			}
+			if params.MaxFileSize >= 0 && job.UploadSize() > params.MaxFileSize {
+				job.Reject(fmt.Sprintf("too large: % .2f, max file size % .2f",
+					decor.SizeB1000(job.UploadSize()), decor.SizeB1000(params.MaxFileSize),
+				))
+			}
+		}(job)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+type JobState string
+
+const (
+	StateWaiting   JobState = "waiting"
+	StateUploading JobState = "uploading"
+	StateUploaded  JobState = "uploaded" // to S3, not yet submitted
+	StateSubmitted JobState = "submitted"
+	// submitted, but not found on the uploads page by --verify
+	StateUnverified JobState = "unverified"
+	StateFailed     JobState = "failed"
+	// failed for good, like a file the upload form doesn't accept or that
+	// doesn't fit into the account, uploading it again won't help
+	StateRejected JobState = "rejected"
+)
+
+// QueuedJob is the saved state of a Job.
+type QueuedJob struct {
+	File     string
+	FileName string
+	FileSize int64
+	Prep     *Preparation `json:",omitempty"`
+	State    JobState
+	Error    string `json:",omitempty"`
+}
+
+// Finished reports whether the job needs nothing more from resume
+func (qj *QueuedJob) Finished() bool {
+	return qj.State == StateSubmitted || qj.State == StateUnverified || qj.State == StateRejected
+}
+
+// Queue is the on-disk state of the last batch of uploads, updated as the
+// jobs progress. It allows the resume command to continue an interrupted
+// batch.
+type Queue struct {
+	// Site is the base URL of the Overcast website
+	Site string
+	Jobs []*QueuedJob
+
+	path string
+	lock sync.Mutex
+	jobs map[*Job]*QueuedJob
+	// err is the last error encountered while saving the queue
+	err error
+}
+
+func queuePath() (string, error) {
+	return configFile("queue.json")
+}
+
+// NewQueue replaces the saved queue with the jobs.
+func NewQueue(site string, jobs []*Job) (*Queue, error) {
+	path, err := queuePath()
+	if err != nil {
+		return nil, err
+	}
+	q := &Queue{
+		Site: site,
+		path: path,
+		jobs: make(map[*Job]*QueuedJob, len(jobs)),
+	}
+	for _, job := range jobs {
+		q.add(job, StateWaiting)
+	}
+	q.save()
+	if q.err != nil {
+		return nil, q.err
+	}
+	return q, nil
+}
+
+// LoadQueue loads the saved queue, returns nil if there is none.
+func LoadQueue() (*Queue, error) {
+	path, err := queuePath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	q := &Queue{
+		path: path,
+		jobs: make(map[*Job]*QueuedJob),
+	}
+	err = json.Unmarshal(data, q)
+	if err != nil {
+		return nil, errors.Wrapf(err, "corrupted queue %s", path)
+	}
+	return q, nil
+}
+
+// absPath returns the absolute path, or the path itself if it can't be made
+// absolute
+func absPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	return abs
+}
+
+func (q *Queue) add(job *Job, state JobState) {
+	// the batch can be resumed from another folder
+	prep := job.Prep
+	if prep != nil && len(prep.Concat) != 0 {
+		copied := *prep
+		copied.Concat = make([]string, len(prep.Concat))
+		for i, file := range prep.Concat {
+			copied.Concat[i] = absPath(file)
+		}
+		prep = &copied
+	}
+	qj := &QueuedJob{
+		File:     absPath(job.File),
+		FileName: job.FileName,
+		FileSize: job.FileSize,
+		Prep:     prep,
+		State:    state,
+	}
+	q.Jobs = append(q.Jobs, qj)
+	q.jobs[job] = qj
+	job.queue = q
+}
+
+// Track associates the job with the saved entry, so its state changes are
+// recorded.
+func (q *Queue) Track(job *Job, qj *QueuedJob) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.jobs[job] = qj
+	job.queue = q
+}
+
+func (q *Queue) save() {
+	data, err := json.MarshalIndent(q, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(q.path, data)
+	}
+	if err != nil {
+		q.err = err
+	}
+}
+
+// SetState records the new state of the job. Does nothing on a nil queue.
+func (q *Queue) SetState(job *Job, state JobState, errMsg string) {
+	if q == nil {
+		return
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	qj := q.jobs[job]
+	if qj == nil {
+		return
+	}
+	qj.State = state
+	qj.Error = errMsg
+	q.save()
+}
+
+// Finished reports whether all jobs were submitted or rejected.
+func (q *Queue) Finished() bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for _, qj := range q.Jobs {
+		if !qj.Finished() {
+			return false
+		}
+	}
+	return true
+}
+
+// Remove deletes the saved queue.
+func (q *Queue) Remove() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	err := os.Remove(q.path)
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	return err
+}
+
+// Err returns the last error encountered while saving the queue.
+func (q *Queue) Err() error {
+	if q == nil {
+		return nil
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.err
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestQueuedJobFinished(t *testing.T) {
+	tests := map[JobState]bool{
+		StateWaiting:    false,
+		StateUploading:  false,
+		StateUploaded:   false,
+		StateFailed:     false,
+		StateSubmitted:  true,
+		StateUnverified: true,
+		StateRejected:   true,
+	}
+	for state, want := range tests {
+		if got := (&QueuedJob{State: state}).Finished(); got != want {
+			t.Errorf("%s: finished %v, want %v", state, got, want)
+		}
+	}
+}
+
+func TestQueueRoundTrip(t *testing.T) {
+	useConfigDir(t)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := NewJob("ep1.mp3", 100)
+	joined := NewJob("/podcasts/a.mp3", 200)
+	joined.FileName = "joined.mp3"
+	joined.Prep = &Preparation{Concat: []string{"/podcasts/a.mp3", "b.mp3"}, Tags: map[string]string{"album": "A"}}
+
+	queue, err := NewQueue("https://overcast.example/", []*Job{plain, joined})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if joined.Prep.Concat[1] != "b.mp3" {
+		t.Errorf("the job is changed: %q", joined.Prep.Concat)
+	}
+	queue.SetState(plain, StateFailed, "SlowDown")
+	queue.SetState(joined, StateUploaded, "")
+	if queue.Err() != nil {
+		t.Fatal(queue.Err())
+	}
+
+	loaded, err := LoadQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Site != "https://overcast.example/" || len(loaded.Jobs) != 2 {
+		t.Fatalf("loaded %+v", loaded)
+	}
+	first, second := loaded.Jobs[0], loaded.Jobs[1]
+	if first.File != filepath.Join(wd, "ep1.mp3") || first.FileName != "ep1.mp3" || first.FileSize != 100 ||
+		first.State != StateFailed || first.Error != "SlowDown" || first.Prep != nil {
+		t.Errorf("first job %+v", first)
+	}
+	if second.File != "/podcasts/a.mp3" || second.FileName != "joined.mp3" || second.State != StateUploaded ||
+		second.Prep.Concat[1] != filepath.Join(wd, "b.mp3") || second.Prep.Tags["album"] != "A" {
+		t.Errorf("second job %+v, %+v", second, second.Prep)
+	}
+	if loaded.Finished() {
+		t.Error("the unfinished queue is finished")
+	}
+
+	// the states are saved through the loaded queue as well
+	resumed := NewJob(first.File, first.FileSize)
+	loaded.Track(resumed, first)
+	loaded.SetState(resumed, StateSubmitted, "")
+	job := NewJob(second.File, second.FileSize)
+	loaded.Track(job, second)
+	loaded.SetState(job, StateRejected, "too large")
+	loaded, err = LoadQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Finished() {
+		t.Errorf("the finished queue isn't: %+v %+v", loaded.Jobs[0], loaded.Jobs[1])
+	}
+
+	if err = loaded.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err = LoadQueue(); loaded != nil || err != nil {
+		t.Errorf("removed queue loaded: %+v, %v", loaded, err)
+	}
+}
+
+func TestLoadQueueCorrupt(t *testing.T) {
+	dir := useConfigDir(t)
+	err := ioutil.WriteFile(filepath.Join(dir, "queue.json"), []byte(`{"Site": "a", "Jobs": [`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queue, err := LoadQueue(); err == nil {
+		t.Errorf("loaded %+v", queue)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Andrew-Morozko/cloudy-uploader/overcast"
+	"github.com/pkg/errors"
+)
+
+type ResubmitArgs struct {
+	CommonArgs
+	Forget bool `arg:"--forget" help:"drop the pending submissions without submitting them"`
+}
+
+func (ResubmitArgs) Description() string {
+	return `Submits to Overcast the files that were uploaded, but not submitted,
+for example because cloudyuploader was interrupted. The files aren't uploaded again.
+`
+}
+
+func (args *ResubmitArgs) Validate() error {
+	return nil
+}
+
+// Run replays the pending upload_succeeded calls from the journal.
+func (args *ResubmitArgs) Run(ctx context.Context) (err error) {
+	journal, err := OpenJournal()
+	if err != nil {
+		return errors.WithMessage(err, "Failed to open the journal")
+	}
+	if args.Forget {
+		return args.forget(journal)
+	}
+
+	uploader, _, err := connect(ctx, &args.CommonArgs)
+	if err != nil {
+		return
+	}
+	site := uploader.Client.BaseURL.String()
+
+	pending := journal.Pending(site)
+	if len(pending) == 0 {
+		fmt.Println("Nothing to resubmit")
+		return
+	}
+
+	history, err := OpenHistory()
+	if err != nil {
+		fmt.Printf("[WARN] Failed to open the history, the submissions won't be recorded: %s\n", err)
+		history = nil
+	}
+
+	var failed int
+	for i, entry := range pending {
+		if i != 0 {
+			// keep the upload dates in order, like performUpload does
+			select {
+			case <-time.After(overcastSubmitDelay):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		err = uploader.Submit(ctx, entry.Key)
+		if err != nil {
+			failed++
+			fmt.Printf("[WARN] Failed to submit \"%s\": %s\n", entry.File, err)
+			continue
+		}
+		journal.Remove(site, entry.Key)
+		history.Add(entry.historyEntry(strings.TrimPrefix(entry.Key, uploader.Key(""))))
+		fmt.Printf("Submitted \"%s\"\n", entry.File)
+	}
+
+	if journal.Err() != nil {
+		fmt.Printf("[WARN] Failed to save the journal: %s\n", journal.Err())
+	}
+	if history.Err() != nil {
+		fmt.Printf("[WARN] Failed to save the history: %s\n", history.Err())
+	}
+	if failed != 0 {
+		return errors.Errorf("%d of %d submissions failed", failed, len(pending))
+	}
+	return nil
+}
+
+// forget drops the pending submissions, no login is needed for that
+func (args *ResubmitArgs) forget(journal *Journal) error {
+	oc, err := overcast.NewClient(nil, args.BaseURL)
+	if err != nil {
+		return errors.WithMessage(err, "Arguments error")
+	}
+	site := oc.BaseURL.String()
+
+	pending := journal.Pending(site)
+	if len(pending) == 0 {
+		fmt.Println("Nothing to forget")
+		return nil
+	}
+	for _, entry := range pending {
+		journal.Remove(site, entry.Key)
+		fmt.Printf("Forgot \"%s\"\n", entry.File)
+	}
+	if journal.Err() != nil {
+		return errors.WithMessage(journal.Err(), "Failed to save the journal")
+	}
+	return nil
+}
+
+// historyEntry returns the history entry of the submitted file, the name is
+// the one on Overcast
+func (entry *JournalEntry) historyEntry(name string) *HistoryEntry {
+	var hash string
+	if !entry.NoHash {
+		hash, _ = hashFile(entry.File)
+	}
+	return newHistoryEntry(entry.Site, entry.Key, name, entry.File, entry.Size, entry.UploadSize, hash)
+}
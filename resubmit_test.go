@@ -0,0 +1,65 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Andrew-Morozko/cloudy-uploader/overcasttest"
+)
+
+func TestResubmit(t *testing.T) {
+	useConfigDir(t)
+	fastDelays(t)
+	srv := overcasttest.NewServer()
+	defer srv.Close()
+	srv.FailSubmits = 1
+
+	file, data := writeMP3(t, t.TempDir(), "ep1.mp3", 20)
+	err := runCLI(srv, file)
+	if err == nil {
+		t.Fatal("the failed submission isn't reported")
+	}
+	key := srv.KeyPrefix + "ep1.mp3"
+	if len(srv.Submitted()) != 0 {
+		t.Fatalf("submitted %v", srv.Submitted())
+	}
+	journal, err := OpenJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending := journal.Pending(srv.URL + "/")
+	if len(pending) != 1 || pending[0].Key != key || pending[0].File != file || pending[0].Size != int64(len(data)) {
+		t.Fatalf("pending %+v", pending)
+	}
+
+	err = runCLI(srv, "resubmit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := srv.Submitted(); !reflect.DeepEqual(got, []string{key}) {
+		t.Errorf("submitted %v", got)
+	}
+	journal, err = OpenJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending := journal.Pending(srv.URL + "/"); len(pending) != 0 {
+		t.Errorf("still pending %+v", pending)
+	}
+	history, err := OpenHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := history.Entries("")
+	if len(entries) != 1 || entries[0].Name != "ep1.mp3" || entries[0].Size != int64(len(data)) || entries[0].SHA256 == "" {
+		t.Errorf("history %+v", entries)
+	}
+
+	err = runCLI(srv, "resubmit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := srv.Submitted(); len(got) != 1 {
+		t.Errorf("submitted again: %v", got)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+type ResumeArgs struct {
+	CommonArgs
+	UploadArgs
+}
+
+func (ResumeArgs) Description() string {
+	return `Continues the last batch of uploads from where it stopped.
+Files already uploaded to Overcast are skipped, files uploaded to the storage,
+but not submitted, are only submitted.
+`
+}
+
+// Run resumes the saved queue.
+func (args *ResumeArgs) Run(ctx context.Context) (err error) {
+	queue, err := LoadQueue()
+	if err != nil {
+		return errors.WithMessage(err, "Failed to load the queue")
+	}
+	if queue == nil || queue.Finished() {
+		fmt.Println("Nothing to resume")
+		return nil
+	}
+
+	uploader, _, err := connect(ctx, &args.CommonArgs)
+	if err != nil {
+		return
+	}
+	if site := uploader.Client.BaseURL.String(); site != queue.Site {
+		return errors.Errorf("the last batch was uploaded to %s, not %s, use --base-url", queue.Site, site)
+	}
+
+	journal, err := OpenJournal()
+	if err != nil {
+		fmt.Printf("[WARN] Failed to open the journal, interrupted uploads won't be resubmittable: %s\n", err)
+		journal = nil
+	}
+
+	history, err := OpenHistory()
+	if err != nil {
+		fmt.Printf("[WARN] Failed to open the history, the uploads won't be recorded: %s\n", err)
+		history = nil
+	}
+
+	jobs := resumeJobs(queue, journal, uploader.Key)
+	if len(jobs) == 0 && queue.Finished() {
+		queue.Remove()
+		fmt.Println("Nothing to resume")
+		return nil
+	}
+	if len(jobs) == 0 {
+		err = errors.New("No files to upload!")
+		return
+	}
+
+	err = checkLimits(jobs, uploader.Params)
+	if err != nil {
+		return
+	}
+
+	return upload(ctx, jobs, &args.UploadArgs, uploader, uploader.Params, journal, history, queue)
+}
+
+// resumeJobs returns the jobs of the queue that aren't finished. The jobs
+// uploaded to S3 are only submitted, unless the resubmit command has
+// already done that. key returns the S3 key of the uploaded name.
+func resumeJobs(queue *Queue, journal *Journal, key func(name string) string) (jobs []*Job) {
+	for _, qj := range queue.Jobs {
+		if qj.Finished() {
+			continue
+		}
+		job := NewJob(qj.File, qj.FileSize)
+		job.FileName = qj.FileName
+		job.Prep = qj.Prep
+
+		switch qj.State {
+		case StateUploaded:
+			if journal != nil && !journal.Has(queue.Site, key(qj.FileName)) {
+				// submitted or forgotten by the resubmit command
+				fmt.Printf("Skipping \"%s\", it's no longer waiting for the submission\n", qj.File)
+				queue.Track(job, qj)
+				queue.SetState(job, StateSubmitted, "")
+				continue
+			}
+			job.uploaded = true
+		default:
+			stat, err := os.Stat(qj.File)
+			if err != nil {
+				fmt.Printf("[WARN] Skipping \"%s\": %s\n", qj.File, err)
+				queue.Track(job, qj)
+				queue.SetState(job, StateRejected, err.Error())
+				continue
+			}
+			// the file might have been fixed since the last attempt
+			job.FileSize = stat.Size()
+			job.uploadSize = job.FileSize
+		}
+		if job.Prep != nil {
+			// known once it's prepared again
+			job.uploadSize = -1
+		}
+		queue.Track(job, qj)
+		jobs = append(jobs, job)
+	}
+	return
+}
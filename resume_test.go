@@ -0,0 +1,107 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Andrew-Morozko/cloudy-uploader/overcasttest"
+)
+
+func TestResumeJobs(t *testing.T) {
+	dir := useConfigDir(t)
+	journal, err := OpenJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal.Add(&JournalEntry{Site: "site", Key: "uploads/pending.mp3", Uploaded: time.Now()})
+	waiting, data := writeMP3(t, dir, "waiting.mp3", 20)
+	failed, _ := writeMP3(t, dir, "failed.mp3", 10)
+
+	queue := &Queue{
+		Site: "site",
+		Jobs: []*QueuedJob{
+			{File: "/done.mp3", FileName: "done.mp3", State: StateSubmitted},
+			{File: "/unverified.mp3", FileName: "unverified.mp3", State: StateUnverified},
+			{File: "/rejected.mp3", FileName: "rejected.mp3", State: StateRejected},
+			{File: "/pending.mp3", FileName: "pending.mp3", FileSize: 7, State: StateUploaded},
+			{File: "/resubmitted.mp3", FileName: "resubmitted.mp3", State: StateUploaded},
+			// changed since the last attempt
+			{File: waiting, FileName: "waiting.mp3", FileSize: 1, State: StateWaiting},
+			{File: failed, FileName: "tagged.mp3", State: StateFailed, Prep: &Preparation{Tags: map[string]string{"album": "A"}}},
+			{File: filepath.Join(dir, "missing.mp3"), FileName: "missing.mp3", State: StateUploading},
+		},
+		path: filepath.Join(dir, "queue.json"),
+		jobs: make(map[*Job]*QueuedJob),
+	}
+
+	jobs := resumeJobs(queue, journal, func(name string) string { return "uploads/" + name })
+	want := []struct {
+		name     string
+		uploaded bool
+		size     int64
+	}{
+		{"pending.mp3", true, 7},
+		{"waiting.mp3", false, int64(len(data))},
+		{"tagged.mp3", false, -1},
+	}
+	if len(jobs) != len(want) {
+		t.Fatalf("got %d jobs, want %d", len(jobs), len(want))
+	}
+	for i, job := range jobs {
+		if job.FileName != want[i].name || job.uploaded != want[i].uploaded || job.UploadSize() != want[i].size {
+			t.Errorf("job %d: %s, uploaded %v, size %d, want %+v", i, job.FileName, job.uploaded, job.UploadSize(), want[i])
+		}
+		if job.queue != queue {
+			t.Errorf("%s isn't tracked", job.FileName)
+		}
+	}
+	if jobs[2].Prep == nil || jobs[2].Prep.Tags["album"] != "A" {
+		t.Errorf("the preparation isn't kept: %+v", jobs[2].Prep)
+	}
+
+	states := map[string]JobState{
+		"resubmitted.mp3": StateSubmitted,
+		"missing.mp3":     StateRejected,
+		"waiting.mp3":     StateWaiting,
+	}
+	for _, qj := range queue.Jobs {
+		if state, found := states[qj.FileName]; found && qj.State != state {
+			t.Errorf("%s is %s, want %s", qj.FileName, qj.State, state)
+		}
+	}
+}
+
+func TestRejectedNotResumed(t *testing.T) {
+	useConfigDir(t)
+	fastDelays(t)
+	srv := overcasttest.NewServer()
+	defer srv.Close()
+	// no audio type is accepted
+	srv.ContentTypePrefix = "video/"
+
+	dir := t.TempDir()
+	ep1, _ := writeMP3(t, dir, "ep1.mp3", 20)
+	ep2, _ := writeMP3(t, dir, "ep2.mp3", 20)
+	err := runCLI(srv, ep1)
+	if err == nil || err.Error() != "1 of 1 uploads failed" {
+		t.Fatalf("got %v, want the failure without resume", err)
+	}
+	// nothing is left to resume
+	if queue, err := LoadQueue(); queue != nil || err != nil {
+		t.Fatalf("queue %+v, %v", queue, err)
+	}
+
+	if err = runCLI(srv, "resume"); err != nil {
+		t.Fatal(err)
+	}
+	srv.Update(func(s *overcasttest.Server) {
+		s.ContentTypePrefix = ""
+	})
+	if err = runCLI(srv, ep2); err != nil {
+		t.Fatalf("the next batch: %v", err)
+	}
+	if got := srv.Submitted(); len(got) != 1 || got[0] != srv.KeyPrefix+"ep2.mp3" {
+		t.Errorf("submitted %v", got)
+	}
+}
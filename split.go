@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Andrew-Morozko/cloudy-uploader/media"
+	"github.com/Andrew-Morozko/cloudy-uploader/overcast"
+	"github.com/pkg/errors"
+	"github.com/vbauerster/mpb/v4/decor"
+)
+
+// splitMargin is the share of the max file size the parts are planned for,
+// the bitrate isn't constant and the tags are copied into every part
+const splitMargin = 0.95
+
+// errSplitTooSmall is returned if even a moment of the audio doesn't fit
+// into the max file size
+var errSplitTooSmall = errors.New("max file size too small to split")
+
+// splitPoints returns the points cutting the duration into even parts not
+// longer than maxLen. A point is moved to the middle of the closest silence
+// within a fifth of the part length, if there is one.
+func splitPoints(duration, maxLen time.Duration, silences []media.Silence) (points []time.Duration, err error) {
+	if maxLen <= 0 {
+		return nil, errSplitTooSmall
+	}
+	var start time.Duration
+	for duration-start > maxLen {
+		remaining := duration - start
+		parts := (remaining + maxLen - 1) / maxLen
+		ideal := start + remaining/parts
+		window := (ideal - start) / 5
+
+		cut := ideal
+		var bestDistance time.Duration = -1
+		for _, silence := range silences {
+			middle := silence.Middle()
+			if middle <= start || middle > start+maxLen {
+				continue
+			}
+			distance := middle - ideal
+			if distance < 0 {
+				distance = -distance
+			}
+			if distance <= window && (bestDistance < 0 || distance < bestDistance) {
+				cut, bestDistance = middle, distance
+			}
+		}
+		points = append(points, cut)
+		start = cut
+	}
+	return points, nil
+}
+
+// partName returns the name of the part, like "Talk (1 of 3).m4a". The
+// number is zero-padded, so the parts are sorted by name.
+func partName(name string, part, parts int) string {
+	ext := filepath.Ext(name)
+	width := len(fmt.Sprint(parts))
+	return fmt.Sprintf("%s (%0*d of %d)%s", strings.TrimSuffix(name, ext), width, part, parts, ext)
+}
+
+// splitFile plans the jobs uploading the file in parts smaller than maxSize
+func splitFile(ctx context.Context, file string, size, maxSize int64, atSilence bool) (jobs []*Job, err error) {
+	info, err := media.Probe(ctx, file)
+	if err != nil {
+		return
+	}
+	maxLen := time.Duration(float64(info.Duration) * float64(maxSize) * splitMargin / float64(size))
+	if maxLen <= 0 {
+		return nil, errSplitTooSmall
+	}
+
+	var silences []media.Silence
+	if atSilence {
+		fmt.Printf("Looking for silence in \"%s\" to split it\n", file)
+		silences, err = media.DetectSilence(ctx, file, nil)
+		if err != nil {
+			return
+		}
+	}
+
+	points, err := splitPoints(info.Duration, maxLen, silences)
+	if err != nil {
+		return
+	}
+	points = append(points, info.Duration)
+	var start time.Duration
+	for i, end := range points {
+		job := NewJob(file, size)
+		job.FileName = partName(job.FileName, i+1, len(points))
+		job.Prep = &Preparation{
+			Start:  start,
+			Length: end - start,
+		}
+		if title := info.Tags["title"]; title != "" {
+			job.Prep.Metadata = map[string]string{
+				"title": fmt.Sprintf("%s (%d of %d)", title, i+1, len(points)),
+			}
+		}
+		job.uploadSize = int64(float64(size) * float64(end-start) / float64(info.Duration))
+		jobs = append(jobs, job)
+		start = end
+	}
+	fmt.Printf("Splitting \"%s\" into %d parts\n", file, len(jobs))
+	return jobs, nil
+}
+
+// findCue returns the cue sheet next to the file, nil if there is none
+func findCue(file string) (*media.CueSheet, error) {
+	for _, path := range []string{
+		strings.TrimSuffix(file, filepath.Ext(file)) + ".cue",
+		file + ".cue",
+	} {
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sheet, err := media.ParseCue(f)
+		f.Close()
+		if err != nil {
+			return nil, errors.WithMessagef(err, "invalid cue sheet %s", path)
+		}
+		return sheet, nil
+	}
+	return nil, nil
+}
+
+// safeTitle makes the title usable in a file name
+func safeTitle(title string) string {
+	return strings.TrimSpace(strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || unicode.IsControl(r) {
+			return '_'
+		}
+		return r
+	}, title))
+}
+
+// chapterName returns the name of the chapter's upload, like
+// "Book - 01 - Title.m4b". The number is zero-padded, so the chapters are
+// sorted by name.
+func chapterName(base string, chapter, chapters int, title, ext string) string {
+	width := len(fmt.Sprint(chapters))
+	if width < 2 {
+		width = 2
+	}
+	name := fmt.Sprintf("%s - %0*d", base, width, chapter)
+	if title = safeTitle(title); title != "" {
+		name += " - " + title
+	}
+	return name + ext
+}
+
+// chapterJobs plans the jobs uploading every chapter of the file separately,
+// the chapters are read from the cue sheet next to the file or from the file
+// itself. Returns nil if the file doesn't have several chapters.
+func chapterJobs(ctx context.Context, file string, size int64, params *overcast.Params, transcode media.Command, transcodeFormat string) (jobs []*Job, err error) {
+	info, err := media.Probe(ctx, file)
+	if err != nil {
+		return
+	}
+	chapters := info.Chapters
+	metadata := map[string]string{}
+
+	sheet, err := findCue(file)
+	if err != nil {
+		return
+	}
+	if sheet != nil {
+		chapters, err = sheet.Chapters(info.Duration)
+		if err != nil {
+			return
+		}
+		if sheet.Title != "" {
+			metadata["album"] = sheet.Title
+		}
+		if sheet.Performer != "" {
+			metadata["artist"] = sheet.Performer
+		}
+	}
+	if len(chapters) < 2 {
+		return nil, nil
+	}
+
+	if params.MaxFileCount >= 0 && len(chapters) > params.MaxFileCount {
+		return nil, errors.Errorf("%d chapters, but only %d more files are allowed", len(chapters), params.MaxFileCount)
+	}
+	if transcode == nil && params.SpaceAvailable >= 0 && size > params.SpaceAvailable {
+		return nil, errors.Errorf("too large: % .2f, % .2f available", decor.SizeB1000(size), decor.SizeB1000(params.SpaceAvailable))
+	}
+
+	ext := filepath.Ext(file)
+	base := strings.TrimSuffix(filepath.Base(file), ext)
+	if transcode != nil {
+		ext = "." + transcodeFormat
+	}
+	for i, chapter := range chapters {
+		job := NewJob(file, size)
+		job.FileName = chapterName(base, i+1, len(chapters), chapter.Title, ext)
+		job.Prep = &Preparation{
+			Start:     chapter.Start,
+			Length:    chapter.End - chapter.Start,
+			Metadata:  map[string]string{"track": fmt.Sprintf("%d/%d", i+1, len(chapters))},
+			Transcode: transcode,
+		}
+		for key, value := range metadata {
+			job.Prep.Metadata[key] = value
+		}
+		if sheet != nil && sheet.Tracks[i].Performer != "" {
+			job.Prep.Metadata["artist"] = sheet.Tracks[i].Performer
+		}
+		if chapter.Title != "" {
+			job.Prep.Metadata["title"] = chapter.Title
+		} else {
+			// otherwise all the chapters would have the title of the file
+			job.Prep.Metadata["title"] = strings.TrimSuffix(job.FileName, ext)
+		}
+
+		job.uploadSize = -1
+		if transcode == nil {
+			job.uploadSize = int64(float64(size) * float64(job.Prep.Length) / float64(info.Duration))
+			if params.MaxFileSize >= 0 && job.uploadSize > params.MaxFileSize {
+				return nil, errors.Errorf("chapter %d is too large: about % .2f, max file size % .2f",
+					i+1, decor.SizeB1000(job.uploadSize), decor.SizeB1000(params.MaxFileSize),
+				)
+			}
+		}
+		jobs = append(jobs, job)
+	}
+	fmt.Printf("Splitting \"%s\" into %d chapters\n", file, len(jobs))
+	return jobs, nil
+}
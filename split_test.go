@@ -0,0 +1,77 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Andrew-Morozko/cloudy-uploader/media"
+)
+
+func TestSplitPoints(t *testing.T) {
+	const min = time.Minute
+	tests := []struct {
+		name     string
+		duration time.Duration
+		maxLen   time.Duration
+		silences []media.Silence
+		want     []time.Duration
+		wantErr  bool
+	}{
+		{name: "fits", duration: 30 * min, maxLen: 30 * min},
+		{name: "even", duration: 90 * min, maxLen: 40 * min, want: []time.Duration{30 * min, 60 * min}},
+		{name: "rounds up", duration: 61 * min, maxLen: 60 * min, want: []time.Duration{30*min + 30*time.Second}},
+		{
+			name: "silence near the point", duration: 60 * min, maxLen: 40 * min,
+			silences: []media.Silence{{Start: 32 * min, End: 34 * min}},
+			want:     []time.Duration{33 * min},
+		},
+		{
+			name: "silence too far", duration: 60 * min, maxLen: 40 * min,
+			silences: []media.Silence{{Start: 10 * min, End: 12 * min}, {Start: 45 * min, End: 47 * min}},
+			want:     []time.Duration{30 * min},
+		},
+		{
+			name: "closest silence", duration: 60 * min, maxLen: 40 * min,
+			silences: []media.Silence{{Start: 25 * min, End: 27 * min}, {Start: 30 * min, End: 32 * min}},
+			want:     []time.Duration{31 * min},
+		},
+		{name: "zero length", duration: 60 * min, maxLen: 0, wantErr: true},
+		{name: "negative length", duration: 60 * min, maxLen: -time.Second, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitPoints(tt.duration, tt.maxLen, tt.silences)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			start := time.Duration(0)
+			for _, point := range append(got, tt.duration) {
+				if !tt.wantErr && point-start > tt.maxLen {
+					t.Errorf("part %v-%v is longer than %v", start, point, tt.maxLen)
+				}
+				start = point
+			}
+		})
+	}
+}
+
+func TestPartName(t *testing.T) {
+	tests := []struct {
+		name        string
+		part, parts int
+		want        string
+	}{
+		{"Talk.m4a", 1, 3, "Talk (1 of 3).m4a"},
+		{"Talk.m4a", 2, 12, "Talk (02 of 12).m4a"},
+		{"Talk", 1, 2, "Talk (1 of 2)"},
+	}
+	for _, tt := range tests {
+		if got := partName(tt.name, tt.part, tt.parts); got != tt.want {
+			t.Errorf("partName(%q, %d, %d) = %q, want %q", tt.name, tt.part, tt.parts, got, tt.want)
+		}
+	}
+}
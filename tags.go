@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Andrew-Morozko/cloudy-uploader/media"
+	"github.com/pkg/errors"
+)
+
+// ManifestEntry sets the tags of a file, the empty fields are left as they
+// are
+type ManifestEntry struct {
+	// File is relative to the manifest
+	File    string `json:"file"`
+	Title   string `json:"title,omitempty"`
+	Album   string `json:"album,omitempty"`
+	Artist  string `json:"artist,omitempty"`
+	Comment string `json:"comment,omitempty"`
+	Artwork string `json:"artwork,omitempty"`
+}
+
+// TagArgs are the options setting the tags of the uploaded files
+type TagArgs struct {
+	Title          string `arg:"--title" help:"title tag of the uploaded files" placeholder:"TITLE"`
+	Album          string `arg:"--album" help:"album tag of the uploaded files, usually the show name" placeholder:"ALBUM"`
+	Artist         string `arg:"--artist" help:"artist tag of the uploaded files" placeholder:"ARTIST"`
+	Comment        string `arg:"--comment" help:"comment tag of the uploaded files" placeholder:"TEXT"`
+	Artwork        string `arg:"--artwork" help:"jpg or png image to embed as the artwork, cover.jpg or folder.jpg next to a file is used by default" placeholder:"FILE"`
+	ReplaceArtwork bool   `arg:"--replace-artwork" help:"embed the artwork even if the file already has one"`
+	Manifest       string `arg:"--manifest" help:"JSON file with the tags of every file, they override the tag options" placeholder:"FILE"`
+	Chapters       string `arg:"--chapters" help:"chapters of the file, one \"HH:MM:SS Title\" per line or JSON; NAME.chapters.txt next to a file is used by default" placeholder:"FILE"`
+
+	// manifest is keyed by the absolute path of the file
+	manifest map[string]*ManifestEntry
+}
+
+// artworkMaxSize is the largest width and height of the embedded artwork,
+// larger images are scaled down
+const artworkMaxSize = 1400
+
+// artworkNames are the images next to the files used as their artwork, in
+// the order of preference
+var artworkNames = []string{"cover.jpg", "cover.jpeg", "cover.png", "folder.jpg", "folder.jpeg", "folder.png"}
+
+// imageSize returns the width and the height of the jpg or png image
+func imageSize(path string) (width, height int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	config, format, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, 0, errors.Errorf("%s isn't a jpg or png image", path)
+	}
+	if format != "jpeg" && format != "png" {
+		return 0, 0, errors.Errorf("%s is %s, only jpg and png are supported", path, format)
+	}
+	return config.Width, config.Height, nil
+}
+
+// checkArtwork checks the image and makes its path absolute, so the resumed
+// jobs find it
+func checkArtwork(artwork *string) (err error) {
+	if _, _, err = imageSize(*artwork); err != nil {
+		return errors.WithMessage(err, "invalid artwork")
+	}
+	*artwork, err = filepath.Abs(*artwork)
+	return
+}
+
+// findArtwork returns the image in the folder used as the artwork of the
+// files in it, "" if there is none
+func findArtwork(dir string) string {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, name := range artworkNames {
+		for _, entry := range entries {
+			if entry.Mode().IsRegular() && strings.EqualFold(entry.Name(), name) {
+				path, err := filepath.Abs(filepath.Join(dir, entry.Name()))
+				if err != nil || checkArtwork(&path) != nil {
+					continue
+				}
+				return path
+			}
+		}
+	}
+	return ""
+}
+
+// fitArtwork returns the artwork scaled down to artworkMaxSize, the image
+// itself if it's small enough
+func fitArtwork(ctx context.Context, artwork string, td *tempDir) (string, error) {
+	width, height, err := imageSize(artwork)
+	if err != nil {
+		return "", err
+	}
+	if width <= artworkMaxSize && height <= artworkMaxSize {
+		return artwork, nil
+	}
+	out, err := td.File("artwork.jpg")
+	if err != nil {
+		return "", err
+	}
+	if err = media.ResizeImage(ctx, artwork, out, artworkMaxSize); err != nil {
+		os.Remove(out)
+		return "", errors.WithMessage(err, "resizing artwork failed")
+	}
+	return out, nil
+}
+
+func (args *TagArgs) Validate() (err error) {
+	if args.Manifest != "" {
+		if err = args.loadManifest(); err != nil {
+			return errors.WithMessage(err, "invalid --manifest")
+		}
+	}
+	if args.Artwork != "" {
+		if err = checkArtwork(&args.Artwork); err != nil {
+			return
+		}
+	}
+	if args.Chapters != "" {
+		if _, err = os.Stat(args.Chapters); err != nil {
+			return errors.Wrap(err, "invalid --chapters")
+		}
+		if _, err = exec.LookPath(media.FFprobe); err != nil {
+			return errors.Errorf("%s not found, it's needed to add the chapters", media.FFprobe)
+		}
+	}
+	if args.Title != "" || args.Album != "" || args.Artist != "" || args.Comment != "" ||
+		args.Artwork != "" || len(args.manifest) != 0 || args.Chapters != "" {
+		if _, err = exec.LookPath(media.FFmpeg); err != nil {
+			return errors.Errorf("%s not found, it's needed to set the tags", media.FFmpeg)
+		}
+	}
+	return nil
+}
+
+func (args *TagArgs) loadManifest() error {
+	data, err := ioutil.ReadFile(args.Manifest)
+	if err != nil {
+		return err
+	}
+	var entries []*ManifestEntry
+	if err = json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	dir := filepath.Dir(args.Manifest)
+	args.manifest = make(map[string]*ManifestEntry, len(entries))
+	for _, entry := range entries {
+		if entry.File == "" {
+			return errors.New("an entry has no file")
+		}
+		file := entry.File
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		if file, err = filepath.Abs(file); err != nil {
+			return err
+		}
+		if entry.Artwork != "" {
+			if !filepath.IsAbs(entry.Artwork) {
+				entry.Artwork = filepath.Join(dir, entry.Artwork)
+			}
+			if err = checkArtwork(&entry.Artwork); err != nil {
+				return errors.WithMessagef(err, "%s", entry.File)
+			}
+		}
+		args.manifest[file] = entry
+	}
+	return nil
+}
+
+// tags returns the tags and the artwork set for the file
+func (args *TagArgs) tags(file string) (tags map[string]string, artwork string) {
+	tags = map[string]string{}
+	set := func(key, value string) {
+		if value != "" {
+			tags[key] = value
+		}
+	}
+	set("title", args.Title)
+	set("album", args.Album)
+	set("artist", args.Artist)
+	set("comment", args.Comment)
+	artwork = args.Artwork
+
+	if abs, err := filepath.Abs(file); err == nil {
+		if entry := args.manifest[abs]; entry != nil {
+			set("title", entry.Title)
+			set("album", entry.Album)
+			set("artist", entry.Artist)
+			set("comment", entry.Comment)
+			if entry.Artwork != "" {
+				artwork = entry.Artwork
+			}
+		}
+	}
+	return
+}
+
+// keepsArtwork reports whether the uploaded file keeps the artwork of the
+// local one
+func keepsArtwork(job *Job) bool {
+	return job.Prep == nil || (job.Prep.Length == 0 && job.Prep.Transcode == nil && len(job.Prep.Concat) == 0)
+}
+
+// tagJobs sets the tags and the artwork of the jobs. The parts and chapters
+// keep their own titles. The artwork isn't replaced unless
+// --replace-artwork is set, and isn't embedded into the formats that can't
+// hold it.
+func (args *TagArgs) tagJobs(ctx context.Context, jobs []*Job) {
+	folders := map[string]string{}
+	_, err := exec.LookPath(media.FFmpeg)
+	canEmbed := err == nil
+	for _, job := range jobs {
+		tags, artwork := args.tags(job.File)
+		if job.Prep != nil && job.Prep.Length != 0 {
+			delete(tags, "title")
+		}
+		if artwork == "" && canEmbed {
+			dir := filepath.Dir(job.File)
+			found, ok := folders[dir]
+			if !ok {
+				found = findArtwork(dir)
+				folders[dir] = found
+			}
+			artwork = found
+		}
+		if artwork != "" && !media.CanEmbed(job.FileName) {
+			fmt.Printf("[WARN] File \"%s\" can't hold the artwork, \"%s\" isn't embedded\n", job.FileName, artwork)
+			artwork = ""
+		}
+		if artwork != "" && !args.ReplaceArtwork && keepsArtwork(job) {
+			info, err := media.Probe(ctx, job.File)
+			if err != nil {
+				// it might have artwork, only --replace-artwork replaces it
+				fmt.Printf("[WARN] Can't check the artwork of \"%s\", it's kept: %s\n", job.File, err)
+				artwork = ""
+			} else if info.Artwork {
+				artwork = ""
+			}
+		}
+		if len(tags) == 0 && artwork == "" {
+			continue
+		}
+		var artworkSize int64
+		if artwork != "" {
+			if stat, err := os.Stat(artwork); err == nil {
+				artworkSize = stat.Size()
+			}
+		}
+		if job.Prep == nil {
+			job.Prep = &Preparation{}
+		}
+		if len(tags) != 0 {
+			job.Prep.Tags = tags
+		}
+		job.Prep.Artwork = artwork
+		if job.uploadSize >= 0 {
+			// the estimate for the size checks, the image might get smaller
+			job.uploadSize += artworkSize
+		}
+	}
+}
+
+// findChapterList returns the chapter list next to the file, "" if there is
+// none
+func findChapterList(file string) string {
+	base := strings.TrimSuffix(file, filepath.Ext(file))
+	for _, path := range []string{
+		base + ".chapters.txt",
+		base + ".chapters.json",
+		file + ".chapters.txt",
+		file + ".chapters.json",
+	} {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// readChapterList reads the chapters of a file of the duration from the
+// list, the invalid chapters are reported and skipped
+func readChapterList(path string, duration time.Duration) ([]media.Chapter, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	parse := media.ParseChapterList
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		parse = media.ParseChapterJSON
+	}
+	list, warnings, err := parse(f)
+	if err != nil {
+		return nil, err
+	}
+	chapters, more := list.Chapters(duration)
+	for _, warning := range append(warnings, more...) {
+		fmt.Printf("[WARN] File \"%s\": %s\n", path, warning)
+	}
+	return chapters, nil
+}
+
+// addChapters sets the chapters of the jobs from --chapters or the chapter
+// lists next to the files. The parts of the files and the joined files get
+// their chapters elsewhere.
+func (args *TagArgs) addChapters(ctx context.Context, jobs []*Job) {
+	for _, job := range jobs {
+		if job.Prep != nil && (job.Prep.Length != 0 || len(job.Prep.Concat) != 0) {
+			continue
+		}
+		path := args.Chapters
+		if path == "" {
+			path = findChapterList(job.File)
+		}
+		if path == "" {
+			continue
+		}
+		if !media.CanEmbed(job.FileName) {
+			fmt.Printf("[WARN] File \"%s\" can't hold chapters, \"%s\" isn't used\n", job.FileName, path)
+			continue
+		}
+		info, err := media.Probe(ctx, job.File)
+		if err != nil {
+			fmt.Printf("[WARN] Failed to add chapters to \"%s\": %s\n", job.File, err)
+			continue
+		}
+		chapters, err := readChapterList(path, info.Duration)
+		if err != nil {
+			fmt.Printf("[WARN] Failed to read chapters \"%s\": %s\n", path, err)
+			continue
+		}
+		if len(chapters) == 0 {
+			continue
+		}
+		if job.Prep == nil {
+			job.Prep = &Preparation{}
+		}
+		job.Prep.Chapters = chapters
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writePNG writes a tiny png image
+func writePNG(t *testing.T, path string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err = png.Encode(f, image.NewGray(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudy-manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ioutil.TempDir("", "cloudy-manifest-other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(other)
+	if err = os.Mkdir(filepath.Join(dir, "art"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writePNG(t, filepath.Join(dir, "art", "cover.png"))
+	writePNG(t, filepath.Join(other, "show.png"))
+	if err = ioutil.WriteFile(filepath.Join(dir, "not-an-image.png"), []byte("text"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		manifest string
+		want     map[string]string // file: artwork
+		wantErr  string
+	}{
+		{
+			name:     "relative to the manifest",
+			manifest: `[{"file": "ep1.mp3", "artwork": "art/cover.png"}, {"file": "sub/ep2.mp3"}]`,
+			want: map[string]string{
+				filepath.Join(dir, "ep1.mp3"):        filepath.Join(dir, "art", "cover.png"),
+				filepath.Join(dir, "sub", "ep2.mp3"): "",
+			},
+		},
+		{
+			name:     "absolute",
+			manifest: `[{"file": "` + filepath.ToSlash(filepath.Join(other, "ep.mp3")) + `", "artwork": "` + filepath.ToSlash(filepath.Join(other, "show.png")) + `"}]`,
+			want: map[string]string{
+				filepath.Join(other, "ep.mp3"): filepath.Join(other, "show.png"),
+			},
+		},
+		{
+			name:     "missing file",
+			manifest: `[{"file": "ep1.mp3"}, {"title": "No file"}]`,
+			wantErr:  "an entry has no file",
+		},
+		{
+			name:     "missing artwork",
+			manifest: `[{"file": "ep1.mp3", "artwork": "art/missing.png"}]`,
+			wantErr:  "ep1.mp3: invalid artwork",
+		},
+		{
+			name:     "invalid artwork",
+			manifest: `[{"file": "ep1.mp3", "artwork": "not-an-image.png"}]`,
+			wantErr:  "isn't a jpg or png image",
+		},
+		{
+			name:     "invalid JSON",
+			manifest: `{"file": "ep1.mp3"}`,
+			wantErr:  "cannot unmarshal",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "manifest.json")
+			if err := ioutil.WriteFile(path, []byte(tt.manifest), 0644); err != nil {
+				t.Fatal(err)
+			}
+			args := &TagArgs{Manifest: path}
+			err := args.loadManifest()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]string{}
+			for file, entry := range args.manifest {
+				got[file] = entry.Artwork
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudy-manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writePNG(t, filepath.Join(dir, "cover.png"))
+	writePNG(t, filepath.Join(dir, "ep2.png"))
+	manifest := filepath.Join(dir, "manifest.json")
+	data := `[{"file": "ep2.mp3", "title": "Second", "artist": "Guest", "artwork": "ep2.png"}]`
+	if err = ioutil.WriteFile(manifest, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	args := &TagArgs{
+		Title:    "Episode",
+		Album:    "The Show",
+		Artist:   "Host",
+		Artwork:  filepath.Join(dir, "cover.png"),
+		Manifest: manifest,
+	}
+	if err = args.loadManifest(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		file        string
+		wantTags    map[string]string
+		wantArtwork string
+	}{
+		{
+			file:        filepath.Join(dir, "ep1.mp3"),
+			wantTags:    map[string]string{"title": "Episode", "album": "The Show", "artist": "Host"},
+			wantArtwork: filepath.Join(dir, "cover.png"),
+		},
+		{
+			// the manifest overrides the options, the empty fields are kept
+			file:        filepath.Join(dir, "ep2.mp3"),
+			wantTags:    map[string]string{"title": "Second", "album": "The Show", "artist": "Guest"},
+			wantArtwork: filepath.Join(dir, "ep2.png"),
+		},
+		{
+			file:        filepath.Join(dir, "sub", "..", "ep2.mp3"),
+			wantTags:    map[string]string{"title": "Second", "album": "The Show", "artist": "Guest"},
+			wantArtwork: filepath.Join(dir, "ep2.png"),
+		},
+	}
+	for _, tt := range tests {
+		tags, artwork := args.tags(tt.file)
+		if !reflect.DeepEqual(tags, tt.wantTags) {
+			t.Errorf("%s: got tags %v, want %v", tt.file, tags, tt.wantTags)
+		}
+		if artwork != tt.wantArtwork {
+			t.Errorf("%s: got artwork %q, want %q", tt.file, artwork, tt.wantArtwork)
+		}
+	}
+}
+
+func TestFindArtwork(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudy-artwork")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if found := findArtwork(dir); found != "" {
+		t.Errorf("found %q in an empty folder", found)
+	}
+	// folder.png is a worse match than cover.png, Cover.jpg isn't an image
+	writePNG(t, filepath.Join(dir, "folder.png"))
+	writePNG(t, filepath.Join(dir, "cover.png"))
+	if err = ioutil.WriteFile(filepath.Join(dir, "Cover.jpg"), []byte("text"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if found, want := findArtwork(dir), filepath.Join(dir, "cover.png"); found != want {
+		t.Errorf("found %q, want %q", found, want)
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Andrew-Morozko/cloudy-uploader/media"
+	"github.com/pkg/errors"
+)
+
+// nameTemplate is the parsed --name-template. The fields are in braces with
+// an optional format after a colon: {date:2006-01-02}, {track:03}.
+type nameTemplate []templatePart
+
+type templatePart struct {
+	// text is the literal text, used if field is empty
+	text   string
+	field  string
+	format string
+}
+
+// parseNameTemplate parses the template, "{{" and "}}" are the literal braces
+func parseNameTemplate(s string) (t nameTemplate, err error) {
+	var text strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], "{{"), strings.HasPrefix(s[i:], "}}"):
+			text.WriteByte(s[i])
+			i++
+		case s[i] == '}':
+			return nil, errors.Errorf("unexpected } at %d", i)
+		case s[i] == '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return nil, errors.Errorf("unclosed { at %d", i)
+			}
+			if text.Len() != 0 {
+				t = append(t, templatePart{text: text.String()})
+				text.Reset()
+			}
+			field := s[i+1 : i+end]
+			part := templatePart{field: field}
+			if colon := strings.IndexByte(field, ':'); colon >= 0 {
+				part.field, part.format = field[:colon], field[colon+1:]
+			}
+			part.field = strings.ToLower(strings.TrimSpace(part.field))
+			if part.field == "" {
+				return nil, errors.Errorf("empty field at %d", i)
+			}
+			t = append(t, part)
+			i += end
+		default:
+			text.WriteByte(s[i])
+		}
+	}
+	if text.Len() != 0 {
+		t = append(t, templatePart{text: text.String()})
+	}
+	return t, nil
+}
+
+// needsTags reports whether the template uses the tags of the files
+func (t nameTemplate) needsTags() bool {
+	for _, part := range t {
+		switch part.field {
+		case "", "name", "ext", "date", "n":
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// formatNumber formats the leading number of the value, like the 3 of the
+// "3/12" track tag, with the width from the format like "03"
+func formatNumber(value, format string) string {
+	end := 0
+	for end < len(value) && '0' <= value[end] && value[end] <= '9' {
+		end++
+	}
+	n, err := strconv.Atoi(value[:end])
+	if err != nil {
+		return value
+	}
+	width, err := strconv.Atoi(format)
+	if err != nil {
+		return value
+	}
+	if strings.HasPrefix(format, "0") {
+		return fmt.Sprintf("%0*d", width, n)
+	}
+	return fmt.Sprintf("%*d", width, n)
+}
+
+// render fills the template for the n-th job of the batch
+func (t nameTemplate) render(job *Job, n int, tags map[string]string) (string, error) {
+	ext := filepath.Ext(job.FileName)
+	var b strings.Builder
+	for _, part := range t {
+		var value string
+		switch part.field {
+		case "":
+			b.WriteString(part.text)
+			continue
+		case "name":
+			value = strings.TrimSuffix(job.FileName, ext)
+		case "ext":
+			value = strings.TrimPrefix(ext, ".")
+		case "date":
+			stat, err := os.Stat(job.File)
+			if err != nil {
+				return "", err
+			}
+			layout := part.format
+			if layout == "" {
+				layout = "2006-01-02"
+			}
+			b.WriteString(safeTitle(stat.ModTime().Format(layout)))
+			continue
+		case "n":
+			value = strconv.Itoa(n)
+		default:
+			value = tags[part.field]
+		}
+		if part.format != "" {
+			value = formatNumber(value, part.format)
+		}
+		b.WriteString(safeTitle(value))
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// jobTags returns the tags the uploaded file will have. The tags of the
+// files are cached in probed, the parts of a file are probed once.
+func jobTags(ctx context.Context, job *Job, probed map[string]map[string]string) (tags map[string]string, err error) {
+	fileTags, found := probed[job.File]
+	if !found {
+		var info *media.Info
+		info, err = media.Probe(ctx, job.File)
+		if err != nil {
+			return
+		}
+		fileTags = info.Tags
+		probed[job.File] = fileTags
+	}
+	tags = make(map[string]string, len(fileTags))
+	for key, value := range fileTags {
+		tags[key] = value
+	}
+	if job.Prep != nil {
+		for key, value := range job.Prep.Metadata {
+			tags[strings.ToLower(key)] = value
+		}
+		for key, value := range job.Prep.Tags {
+			tags[strings.ToLower(key)] = value
+		}
+	}
+	return
+}
+
+// renameJobs sets the uploaded names of the jobs from the template, the
+// local files aren't renamed
+func (t nameTemplate) renameJobs(ctx context.Context, jobs []*Job) {
+	probed := map[string]map[string]string{}
+	for i, job := range jobs {
+		var tags map[string]string
+		if t.needsTags() {
+			var err error
+			tags, err = jobTags(ctx, job, probed)
+			if err != nil {
+				fmt.Printf("[WARN] Failed to read the tags of \"%s\": %s\n", job.File, err)
+			}
+		}
+		name, err := t.render(job, i+1, tags)
+		if err != nil {
+			fmt.Printf("[WARN] Failed to name \"%s\": %s\n", job.File, err)
+			continue
+		}
+		ext := filepath.Ext(job.FileName)
+		if !strings.EqualFold(filepath.Ext(name), ext) {
+			// the extension tells Overcast the format
+			name += ext
+		}
+		if strings.TrimSuffix(name, ext) == "" {
+			fmt.Printf("[WARN] The template gives an empty name for \"%s\", keeping \"%s\"\n", job.File, job.FileName)
+			continue
+		}
+		job.FileName = name
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseNameTemplate(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    nameTemplate
+		wantErr bool
+	}{
+		{in: "{name}.{ext}", want: nameTemplate{{field: "name"}, {text: "."}, {field: "ext"}}},
+		{in: "{date:2006-01-02} {Album} - {track:03}", want: nameTemplate{
+			{field: "date", format: "2006-01-02"}, {text: " "}, {field: "album"}, {text: " - "}, {field: "track", format: "03"},
+		}},
+		{in: "{ n }", want: nameTemplate{{field: "n"}}},
+		{in: "{{literal}} {n}", want: nameTemplate{{text: "{literal} "}, {field: "n"}}},
+		{in: "{time:15:04}", want: nameTemplate{{field: "time", format: "15:04"}}},
+		{in: "plain", want: nameTemplate{{text: "plain"}}},
+		{in: "", want: nil},
+		{in: "{name", wantErr: true},
+		{in: "name}", wantErr: true},
+		{in: "{}", wantErr: true},
+		{in: "{:03}", wantErr: true},
+		{in: "{{name}", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseNameTemplate(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseNameTemplate(%q): error %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseNameTemplate(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNeedsTags(t *testing.T) {
+	for in, want := range map[string]bool{
+		"{name}.{ext}":         false,
+		"{date} {n:03}":        false,
+		"{album} - {name}":     true,
+		"{track:02} {title}":   true,
+		"{{album}} {name}.mp3": false,
+	} {
+		template, err := parseNameTemplate(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := template.needsTags(); got != want {
+			t.Errorf("%q.needsTags() = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestFormatNumber(t *testing.T) {
+	tests := []struct {
+		value, format, want string
+	}{
+		{"3", "03", "003"},
+		{"3/12", "02", "03"},
+		{"123", "02", "123"},
+		{"7", "3", "  7"},
+		{"07", "1", "7"},
+		{"", "03", ""},
+		{"side A", "03", "side A"},
+		{"3", "x", "3"},
+	}
+	for _, tt := range tests {
+		if got := formatNumber(tt.value, tt.format); got != tt.want {
+			t.Errorf("formatNumber(%q, %q) = %q, want %q", tt.value, tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestRenderNameTemplate(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "raw take.mp3")
+	if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	date := time.Date(2021, 5, 4, 10, 0, 0, 0, time.Local)
+	if err := os.Chtimes(file, date, date); err != nil {
+		t.Fatal(err)
+	}
+	job := NewJob(file, 0)
+	tags := map[string]string{"album": "Show/Name", "track": "2/10", "title": " Pilot "}
+	tests := []struct {
+		template, want string
+	}{
+		{"{date} {album} - {track:03} {title}.{ext}", "2021-05-04 Show_Name - 002 Pilot.mp3"},
+		{"{n:02} {name}", "07 raw take"},
+		{"{date:Jan 2} {artist}", "May 4"},
+		{"{{{n}}}", "{7}"},
+	}
+	for _, tt := range tests {
+		template, err := parseNameTemplate(tt.template)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := template.render(job, 7, tags)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%q rendered %q, want %q", tt.template, got, tt.want)
+		}
+	}
+}
@@ -1,32 +1,59 @@
 package main
 
 import (
-	"bytes"
-
+	"context"
 	"fmt"
 	"io"
-	"mime/multipart"
-	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/Andrew-Morozko/cloudy-uploader/mbpdecor"
-
+	"github.com/Andrew-Morozko/cloudy-uploader/overcast"
 	"github.com/pkg/errors"
+
 	"github.com/vbauerster/mpb/v4"
 	"github.com/vbauerster/mpb/v4/decor"
 )
 
 type Job struct {
-	File             string
-	FileName         string
-	FileSize         int64
-	ProgressBars     []*mpb.Bar
-	status           *mbpdecor.StatusDecorator
+	File     string
+	FileName string
+	FileSize int64
+	// Prep, if set, describes how the uploaded file is made from File
+	Prep         *Preparation
+	ProgressBars []*mpb.Bar
+	status       *mbpdecor.StatusDecorator
+	uploadStatus *mbpdecor.StatusDecorator
+	// levels is the loudness before and after the normalization
+	levels string
+	// prepStatus and sizeStatus are shown until the upload begins
+	prepStatus       *mbpdecor.StatusDecorator
+	sizeStatus       *mbpdecor.StatusDecorator
 	isDone           bool
+	failed           bool
 	amazonUploadDone chan struct{}
+	// uploaded is set for the jobs that are already in S3 and only need
+	// to be submitted
+	uploaded bool
+	// submitted is set once Overcast accepts the submission, the job can
+	// still fail the --verify check
+	submitted bool
+	// rejected is set for the jobs that failed for good, see Reject
+	rejected bool
+	// key is the S3 key the file was uploaded under in this run, see Key
+	key string
+	// unsafeName is the name before it was made safe for the storage, the
+	// file might have been uploaded under it by other means
+	unsafeName string
+	queue      *Queue
+	// sha256 is the cached hash of the file, see SHA256
+	sha256 string
+	// uploadFile is the prepared file, if there is one
+	uploadFile string
+	// uploadSize is the size of the file to upload, see UploadSize
+	uploadSize int64
 }
 
 func NewJob(file string, filesize int64) *Job {
@@ -34,10 +61,47 @@ func NewJob(file string, filesize int64) *Job {
 		File:             file,
 		FileName:         filepath.Base(file),
 		FileSize:         filesize,
+		uploadSize:       filesize,
 		amazonUploadDone: make(chan struct{}),
 	}
 }
 
+// UploadFile returns the path of the file to upload
+func (job *Job) UploadFile() string {
+	if job.uploadFile != "" {
+		return job.uploadFile
+	}
+	return job.File
+}
+
+// UploadSize returns the size of the file to upload. For the jobs that aren't
+// prepared yet it's an estimate, or -1 if it's unknown.
+func (job *Job) UploadSize() int64 {
+	return job.uploadSize
+}
+
+// formatSize formats the size for the progress bars
+func formatSize(size int64) string {
+	if size < 0 {
+		return "?"
+	}
+	return fmt.Sprintf("% .1f", decor.SizeB1000(size))
+}
+
+// hashed reports whether the hash of File identifies the upload. The joined
+// files and the parts aren't the file.
+func (job *Job) hashed() bool {
+	return job.Prep == nil || (len(job.Prep.Concat) == 0 && job.Prep.Length == 0)
+}
+
+// SHA256 returns the hex encoded hash of the file, it's only computed once
+func (job *Job) SHA256() (hash string, err error) {
+	if job.sha256 == "" {
+		job.sha256, err = hashFile(job.File)
+	}
+	return job.sha256, err
+}
+
 func (job *Job) setEndState(msg string) {
 	job.isDone = true
 	job.status.SetStatus(msg)
@@ -49,22 +113,147 @@ func (job *Job) setEndState(msg string) {
 }
 
 func (job *Job) Done() {
-	job.setEndState("Uploaded!")
+	job.queue.SetState(job, StateSubmitted, "")
+	if job.levels != "" {
+		job.setEndState("Uploaded! " + job.levels)
+	} else {
+		job.setEndState("Uploaded!")
+	}
 }
 
 func (job *Job) SetError(msg string) {
+	job.failed = true
+	if job.submitted {
+		// only the verification has failed, submitting again would add
+		// the file twice
+		job.queue.SetState(job, StateUnverified, msg)
+	} else if job.uploaded {
+		// only the submission has failed, no need to upload again
+		job.queue.SetState(job, StateUploaded, msg)
+	} else {
+		job.queue.SetState(job, StateFailed, msg)
+	}
+	job.setEndState("Error: " + msg)
+}
+
+// Reject fails the job for good, resume won't retry it
+func (job *Job) Reject(msg string) {
+	job.failed = true
+	job.rejected = true
+	job.queue.SetState(job, StateRejected, msg)
 	job.setEndState("Error: " + msg)
 }
 
+// BeginUpload is called before every upload attempt.
+// The total is one byte larger than the request, otherwise the bar would
+// complete as soon as the body is sent, and a completed bar can't be reused
+// for a retry. The bar is completed by EndUpload.
 func (job *Job) BeginUpload(totalSize int64) {
-	job.ProgressBars[1].SetTotal(totalSize, false)
+	job.ProgressBars[1].SetTotal(totalSize+1, false)
+	job.ProgressBars[1].SetCurrent(0)
+	job.ProgressBars[1].AdjustAverageDecorators(time.Now())
+	job.ProgressBars[0].SetTotal(0, true)
+}
+
+// SkipUpload is used instead of the upload for the jobs already in S3
+func (job *Job) SkipUpload() {
 	job.ProgressBars[0].SetTotal(0, true)
+	job.ProgressBars[1].SetTotal(0, true)
 }
+
+func (job *Job) EndUpload() {
+	job.ProgressBars[1].SetTotal(0, true)
+}
+
 func (job *Job) GetUploadReader(reader io.Reader) io.ReadCloser {
 	return job.ProgressBars[1].ProxyReader(reader)
 }
 
-func performUpload(jobs []*Job, maxParallel int, unorderedSubmit bool, overcastParams *OvercastParams) {
+func (job *Job) trackUpload(totalSize int64, body io.Reader) io.Reader {
+	job.BeginUpload(totalSize)
+	return job.GetUploadReader(body)
+}
+
+// uploadToAmazon uploads the file to S3 and records it in the journal
+func (job *Job) uploadToAmazon(ctx context.Context, uploader *overcast.Uploader, journal *Journal, args *UploadArgs) error {
+	defer job.EndUpload()
+	job.queue.SetState(job, StateUploading, "")
+	err := job.uploadChanging(ctx, uploader, args)
+	if err != nil {
+		return err
+	}
+	job.uploaded = true
+	job.queue.SetState(job, StateUploaded, "")
+	journal.Add(job.journalEntry(uploader.Client.BaseURL.String(), job.Key(uploader)))
+	if job.uploadFile != "" {
+		// only needed for the upload
+		os.Remove(job.uploadFile)
+	}
+	return nil
+}
+
+// Key returns the S3 key of the uploaded file. The key prefix of the form
+// may change when it's refreshed, so the key of the upload is kept.
+func (job *Job) Key(uploader *overcast.Uploader) string {
+	if job.key != "" {
+		return job.key
+	}
+	return uploader.Key(job.FileName)
+}
+
+// submitToOvercast submits the uploaded file, removes it from the journal
+// and records it in the history. With verify the file has to show up on the
+// uploads page to be recorded.
+func (job *Job) submitToOvercast(ctx context.Context, uploader *overcast.Uploader, journal *Journal, history *History, verify bool) error {
+	key := job.Key(uploader)
+	err := uploader.Submit(ctx, key)
+	if err != nil {
+		return err
+	}
+	job.submitted = true
+	site := uploader.Client.BaseURL.String()
+	journal.Remove(site, key)
+	if verify {
+		err = job.verifyListed(ctx, uploader.Client)
+		if err != nil {
+			return errors.WithMessage(err, "submitted, but not verified, check the uploads page before uploading it again")
+		}
+	}
+	if history != nil {
+		history.Add(job.historyEntry(site, key))
+	}
+	return nil
+}
+
+// journalEntry returns the journal entry of the uploaded job, the history
+// entry made from it by the resubmit command is the same as historyEntry
+func (job *Job) journalEntry(site, key string) *JournalEntry {
+	return &JournalEntry{
+		Site:       site,
+		Key:        key,
+		File:       absPath(job.File),
+		Size:       job.FileSize,
+		UploadSize: job.UploadSize(),
+		NoHash:     !job.hashed(),
+		Uploaded:   time.Now(),
+	}
+}
+
+func (job *Job) historyEntry(site, key string) *HistoryEntry {
+	var hash string
+	if job.hashed() {
+		// the file might be gone by now for the resumed jobs, that's fine
+		hash, _ = job.SHA256()
+	}
+	return newHistoryEntry(site, key, job.FileName, job.File, job.FileSize, job.UploadSize(), hash)
+}
+
+// overcastSubmitDelay is the pause between ordered submissions, so that
+// the upload dates are distinct
+var overcastSubmitDelay = 2 * time.Second
+
+// newProgress shows the progress bars of the jobs
+func newProgress(jobs []*Job) *mpb.Progress {
 	bars := mpb.New()
 
 	var bar *mpb.Bar
@@ -72,20 +261,22 @@ func performUpload(jobs []*Job, maxParallel int, unorderedSubmit bool, overcastP
 		// setting up bar progression for this job
 		jobTitle := strings.TrimSuffix(job.FileName, filepath.Ext(job.FileName)) + ":"
 
+		job.prepStatus = mbpdecor.Status("Waiting", decor.WCSyncWidthR)
+		job.sizeStatus = mbpdecor.Status(
+			formatSize(job.UploadSize()),
+			decor.WCSyncWidth,
+		)
 		bar = bars.AddSpinner(1,
 			mpb.SpinnerOnLeft,
 			mpb.PrependDecorators(
 				decor.Name(jobTitle, decor.WCSyncSpaceR),
 				decor.Merge(
-					decor.Name("Waiting", decor.WCSyncWidthR),
+					job.prepStatus,
 					decor.WCSyncWidth,
 				),
 			),
 			mpb.AppendDecorators(
-				decor.Name(
-					fmt.Sprintf("% .1f", decor.SizeB1000(job.FileSize)),
-					decor.WCSyncWidth,
-				),
+				job.sizeStatus,
 				decor.Name(
 					"",
 					decor.WCSyncSpace,
@@ -98,11 +289,13 @@ func performUpload(jobs []*Job, maxParallel int, unorderedSubmit bool, overcastP
 		)
 		job.ProgressBars = append(job.ProgressBars, bar)
 
+		job.uploadStatus = mbpdecor.Status("Uploading @ ", decor.WCSyncWidthR)
+
 		bar = bars.AddBar(1, // Will be set later, after the total request length is calculated
 			mpb.BarParkTo(bar),
 			mpb.PrependDecorators(
 				decor.Name(jobTitle, decor.WCSyncSpaceR),
-				decor.Name("Uploading @ ", decor.WCSyncWidthR),
+				job.uploadStatus,
 				decor.AverageSpeed(decor.UnitKB, "% .2f", decor.WCSyncWidth),
 			),
 			mpb.AppendDecorators(
@@ -123,31 +316,65 @@ func performUpload(jobs []*Job, maxParallel int, unorderedSubmit bool, overcastP
 				decor.Name(jobTitle, decor.WCSyncSpaceR),
 				decor.Merge(
 					job.status,
-					decor.WCSyncWidthR,
 					decor.WCSyncWidth,
 				),
 			),
 		)
 		job.ProgressBars = append(job.ProgressBars, bar)
 	}
+	return bars
+}
 
-	amazonUploadPermissionC := make(chan struct{}, maxParallel)
-	for i := 0; i < maxParallel; i++ {
+// abortJobs finishes the jobs that haven't failed yet with the error. They
+// aren't left for resume, the batch has to be changed to be uploaded.
+func abortJobs(bars *mpb.Progress, jobs []*Job, err error) error {
+	for _, job := range jobs {
+		if !job.isDone {
+			job.queue.SetState(job, StateRejected, err.Error())
+			job.setEndState("Not uploaded")
+		}
+	}
+	bars.Wait()
+	return err
+}
+
+// performUpload uploads and submits the jobs, returns the number of failed ones.
+// The jobs that are already finished are skipped.
+func performUpload(ctx context.Context, bars *mpb.Progress, jobs []*Job, args *UploadArgs, uploader *overcast.Uploader, journal *Journal, history *History) (failed int) {
+	amazonUploadPermissionC := make(chan struct{}, args.MaxParallel)
+	for i := 0; i < args.MaxParallel; i++ {
 		amazonUploadPermissionC <- struct{}{}
 	}
 	go func() {
 		for _, job := range jobs {
-			<-amazonUploadPermissionC
+			if job.isDone {
+				close(job.amazonUploadDone)
+				continue
+			}
+			if !job.uploaded {
+				<-amazonUploadPermissionC
+			}
 			go func(job *Job) {
-				err := uploadToAmazon(job, overcastParams.UploadURL, overcastParams.PostData)
-				amazonUploadPermissionC <- struct{}{}
-				if err != nil {
-					job.SetError(err.Error())
+				if job.uploaded {
+					job.SkipUpload()
+				} else {
+					err := job.uploadToAmazon(ctx, uploader, journal, args)
+					amazonUploadPermissionC <- struct{}{}
+					if err != nil {
+						job.SetError(err.Error())
+						close(job.amazonUploadDone)
+						return
+					}
+					if history != nil && job.hashed() {
+						// hash while the file is probably still cached, not
+						// in the way of the ordered submission
+						job.SHA256()
+					}
 				}
 				close(job.amazonUploadDone)
-				if unorderedSubmit {
+				if args.UnorderedSubmit {
 					job.status.SetStatus("Submitting")
-					err := submitToOvercast(job, overcastParams.DataKeyPrefix)
+					err := job.submitToOvercast(ctx, uploader, journal, history, args.Verify)
 					if err != nil {
 						job.SetError(err.Error())
 					} else {
@@ -158,10 +385,9 @@ func performUpload(jobs []*Job, maxParallel int, unorderedSubmit bool, overcastP
 		}
 	}()
 
-	if !unorderedSubmit {
+	if !args.UnorderedSubmit {
 		overcastSubmitPermissionC := make(chan struct{}, 1)
 		overcastSubmitPermissionC <- struct{}{}
-		overcastSubmitDelay := 2 * time.Second
 
 		for _, job := range jobs {
 			<-job.amazonUploadDone
@@ -171,7 +397,7 @@ func performUpload(jobs []*Job, maxParallel int, unorderedSubmit bool, overcastP
 
 			<-overcastSubmitPermissionC
 			job.status.SetStatus("Submitting")
-			err := submitToOvercast(job, overcastParams.DataKeyPrefix)
+			err := job.submitToOvercast(ctx, uploader, journal, history, args.Verify)
 			if err != nil {
 				job.SetError(err.Error())
 				overcastSubmitPermissionC <- struct{}{}
@@ -185,120 +411,11 @@ func performUpload(jobs []*Job, maxParallel int, unorderedSubmit bool, overcastP
 	}
 
 	bars.Wait()
-}
-
-func dumpBytesFromBuf(byteBuf *bytes.Buffer) ([]byte, error) {
-	array := make([]byte, byteBuf.Len())
-	_, err := byteBuf.Read(array)
-	if err != nil {
-		return nil, err
-	}
-	return array, nil
-}
-
-func uploadToAmazon(job *Job, uploadUrl string, postData map[string]string) (err error) {
-	//buffer for storing multipart data
-	byteBuf := &bytes.Buffer{}
 
-	//part: parameters
-	mpWriter := multipart.NewWriter(byteBuf)
-
-	for key, value := range postData {
-		err = mpWriter.WriteField(key, value)
-		if err != nil {
-			return
+	for _, job := range jobs {
+		if job.failed {
+			failed++
 		}
 	}
-
-	_, err = mpWriter.CreateFormFile("file", job.FileName)
-	if err != nil {
-		return
-	}
-	multipartStart, err := dumpBytesFromBuf(byteBuf)
-	if err != nil {
-		return
-	}
-	err = mpWriter.Close()
-	if err != nil {
-		return
-	}
-	multipartEnd, err := dumpBytesFromBuf(byteBuf)
-	if err != nil {
-		return
-	}
-
-	//calculate content length
-	totalSize := int64(len(multipartStart)) + job.FileSize + int64(len(multipartEnd))
-	job.BeginUpload(totalSize)
-
-	file, err := os.Open(job.File)
-	if err != nil {
-		return
-	}
-	defer file.Close()
-
-	comboReader := io.MultiReader(
-		bytes.NewReader(multipartStart),
-		io.LimitReader(file, job.FileSize), // Just in case the file would be modified while uploading
-		bytes.NewReader(multipartEnd),
-	)
-
-	req, err := http.NewRequest("POST", uploadUrl, job.GetUploadReader(comboReader))
-	if err != nil {
-		return
-	}
-
-	req.Header.Set("Content-Type", mpWriter.FormDataContentType())
-	req.Header.Set("Origin", "https://overcast.fm")
-	req.ContentLength = totalSize
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return
-	}
-	resp.Body.Close()
-
-	if resp.StatusCode != 204 {
-		return errors.Errorf("Unexpected status code from amazon: %d", resp.StatusCode)
-	}
-	return
-}
-
-func submitToOvercast(job *Job, dataKeyPrefix string) (err error) {
-	byteBuf := &bytes.Buffer{}
-	mpWriter := multipart.NewWriter(byteBuf)
-
-	amazonKey := dataKeyPrefix + job.FileName
-	err = mpWriter.WriteField("key", amazonKey)
-	if err != nil {
-		return
-	}
-	err = mpWriter.Close()
-	if err != nil {
-		return
-	}
-
-	req, err := http.NewRequest("POST", "https://overcast.fm/podcasts/upload_succeeded", byteBuf)
-	if err != nil {
-		return
-	}
-	req.Header.Set("Content-Type", mpWriter.FormDataContentType())
-	req.Header.Set("Origin", "https://overcast.fm")
-	req.ContentLength = int64(byteBuf.Len())
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return
-	}
-
-	if resp.StatusCode != 200 {
-		return errors.New("Unexpected status code from overcast")
-	}
-
-	err = resp.Body.Close()
-	if err != nil {
-		return
-	}
-
 	return
 }
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/Andrew-Morozko/cloudy-uploader/overcasttest"
+)
+
+func TestUploadCLI(t *testing.T) {
+	useConfigDir(t)
+	fastDelays(t)
+	srv := overcasttest.NewServer()
+	defer srv.Close()
+
+	dir := t.TempDir()
+	ep1, data1 := writeMP3(t, dir, "ep1.mp3", 40)
+	ep2, data2 := writeMP3(t, dir, "ep2.mp3", 60)
+	err := runCLI(srv, ep1, ep2, "--verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := []string{srv.KeyPrefix + "ep1.mp3", srv.KeyPrefix + "ep2.mp3"}
+	if got := srv.Submitted(); !reflect.DeepEqual(got, keys) {
+		t.Errorf("submitted %v, want %v", got, keys)
+	}
+	for i, data := range [][]byte{data1, data2} {
+		if stored, _ := srv.Object(keys[i]); !bytes.Equal(stored, data) {
+			t.Errorf("%s has %d bytes, want %d", keys[i], len(stored), len(data))
+		}
+	}
+
+	history, err := OpenHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := history.Entries("")
+	if len(entries) != 2 || entries[0].File != ep1 || entries[1].Size != int64(len(data2)) || entries[1].SHA256 == "" {
+		t.Errorf("history %+v", entries)
+	}
+	journal, err := OpenJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending := journal.Pending(entries[0].Site); len(pending) != 0 {
+		t.Errorf("still pending %+v", pending)
+	}
+	if queue, err := LoadQueue(); queue != nil || err != nil {
+		t.Errorf("the queue of the finished batch is kept: %v", err)
+	}
+
+	// the files are found on the uploads page
+	err = runCLI(srv, ep1, ep2, "--on-duplicate", "skip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := srv.Submitted(); len(got) != 2 {
+		t.Errorf("submitted again: %v", got)
+	}
+}
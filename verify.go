@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/Andrew-Morozko/cloudy-uploader/overcast"
+	"github.com/pkg/errors"
+	"github.com/vbauerster/mpb/v4/decor"
+)
+
+// Overcast may list a submitted file with a delay, especially when it's
+// busy, so the uploads page is checked again after each of the pauses,
+// for about half a minute in total
+var verifyDelays = []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second}
+
+// verifyListed checks that the submitted file is on the uploads page with
+// the uploaded size
+func (job *Job) verifyListed(ctx context.Context, client *overcast.Client) error {
+	var sameName *overcast.Upload
+	for attempt := 0; attempt <= len(verifyDelays); attempt++ {
+		if attempt != 0 {
+			select {
+			case <-time.After(verifyDelays[attempt-1]):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		page, err := client.UploadsPage(ctx)
+		if err != nil {
+			return errors.WithMessage(err, "failed to verify the upload")
+		}
+		uploads := page.Uploads()
+		if findUpload(uploads, job.FileName, job.UploadSize()) != nil {
+			return nil
+		}
+		sameName = findUpload(uploads, job.FileName, -1)
+	}
+	if sameName != nil {
+		return errors.Errorf("the uploads page lists it with % .2f instead of % .2f",
+			decor.SizeB1000(sameName.Size), decor.SizeB1000(job.UploadSize()),
+		)
+	}
+	return errors.Errorf("\"%s\" isn't on the uploads page after the submission", job.FileName)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Andrew-Morozko/cloudy-uploader/overcast"
+	"github.com/Andrew-Morozko/cloudy-uploader/overcasttest"
+)
+
+// queuedState returns the state of the only job of the saved queue
+func queuedState(t *testing.T) (JobState, string) {
+	t.Helper()
+	queue, err := LoadQueue()
+	if err != nil || queue == nil || len(queue.Jobs) != 1 {
+		t.Fatalf("queue %+v, %v", queue, err)
+	}
+	return queue.Jobs[0].State, queue.Jobs[0].Error
+}
+
+func TestVerifyCorruptedUpload(t *testing.T) {
+	useConfigDir(t)
+	fastDelays(t)
+	srv := overcasttest.NewServer()
+	defer srv.Close()
+	srv.CorruptUploads = 1
+
+	path, _ := writeMP3(t, t.TempDir(), "ep.mp3", 20)
+	err := runCLI(srv, path, "--verify")
+	if err == nil || !strings.Contains(err.Error(), `run "cloudyuploader resume" to retry them`) {
+		t.Fatalf("got %v, want a failure to resume", err)
+	}
+	if len(srv.Submitted()) != 0 {
+		t.Fatalf("the damaged upload is submitted: %v", srv.Submitted())
+	}
+	if state, msg := queuedState(t); state != StateFailed || !strings.Contains(msg, "the upload is damaged") {
+		t.Errorf("queued as %s: %s", state, msg)
+	}
+	journal, err := OpenJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending := journal.Pending(srv.URL); len(pending) != 0 {
+		t.Errorf("the damaged upload is in the journal: %+v", pending)
+	}
+
+	if err = runCLI(srv, "resume", "--verify"); err != nil {
+		t.Fatal(err)
+	}
+	if got := srv.Submitted(); len(got) != 1 {
+		t.Errorf("submitted %v after resume", got)
+	}
+}
+
+func TestVerifyLostSubmission(t *testing.T) {
+	useConfigDir(t)
+	fastDelays(t)
+	srv := overcasttest.NewServer()
+	defer srv.Close()
+	srv.LoseSubmits = 1
+
+	path, _ := writeMP3(t, t.TempDir(), "ep.mp3", 20)
+	err := runCLI(srv, path, "--verify")
+	if err == nil || err.Error() != "1 of 1 uploads failed" {
+		t.Fatalf("got %v, want a failure without resume", err)
+	}
+	// nothing is left to resume, submitting again could add it twice
+	if queue, err := LoadQueue(); queue != nil || err != nil {
+		t.Errorf("the queue is kept: %v", err)
+	}
+	journal, err := OpenJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending := journal.Pending(srv.URL); len(pending) != 0 {
+		t.Errorf("the submitted upload is in the journal: %+v", pending)
+	}
+	history, err := OpenHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := history.Entries(""); len(entries) != 0 {
+		t.Errorf("the lost upload is in the history: %+v", entries)
+	}
+	if got := srv.Submitted(); len(got) != 1 {
+		t.Errorf("submitted %v", got)
+	}
+}
+
+func TestVerifyListed(t *testing.T) {
+	fastDelays(t)
+	srv := overcasttest.NewServer()
+	defer srv.Close()
+	srv.AddUpload("listed.mp3", 20000, time.Now())
+	oc, err := overcast.NewClient(nil, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = oc.Login(context.Background(), &overcast.Creds{Email: srv.Email, Password: srv.Password}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		size    int64
+		wantErr string
+	}{
+		{"listed.mp3", 20000, ""},
+		{"listed.mp3", 90000, "the uploads page lists it with"},
+		{"lost.mp3", 20000, `"lost.mp3" isn't on the uploads page after the submission`},
+	}
+	for _, tt := range tests {
+		job := NewJob("/"+tt.name, tt.size)
+		err := job.verifyListed(context.Background(), oc)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%s of %d bytes: got %v, want %q", tt.name, tt.size, err, tt.wantErr)
+		}
+	}
+}